@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adminController 是管理接口可以调用的控制器操作
+type adminController interface {
+	Status() ControllerStatus
+	// SetFrozen 开启或关闭全局冻结
+	SetFrozen(frozen bool)
+	Bindings() []BindingStatus
+	// SetPaused 暂停或恢复一个绑定
+	SetPaused(key BindingKey, paused bool) error
+	// Resync 立即同步 Deployment 的所有绑定
+	Resync(namespace, deploymentName string) error
+}
+
+// resyncRequest 是 /admin/resync 的请求体
+type resyncRequest struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+}
+
+// adminAPI 提供需要 Bearer token 认证的管理接口
+type adminAPI struct {
+	token      string
+	controller adminController
+}
+
+func newAdminAPI(token string, controller adminController) *adminAPI {
+	return &adminAPI{token: token, controller: controller}
+}
+
+func (a *adminAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/freeze", a.authorized(a.handleFreeze))
+	mux.HandleFunc("/admin/bindings", a.authorized(a.handleBindings))
+	mux.HandleFunc("/admin/bindings/pause", a.authorized(a.handlePause(true)))
+	mux.HandleFunc("/admin/bindings/resume", a.authorized(a.handlePause(false)))
+	mux.HandleFunc("/admin/resync", a.authorized(a.handleResync))
+	mux.HandleFunc("/admin/log-level", a.authorized(a.handleLogLevel))
+}
+
+// authorized 校验请求的 Authorization: Bearer <token>
+func (a *adminAPI) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleFreeze 处理 /admin/freeze：GET 查询冻结状态，POST 开启冻结，DELETE 解除冻结
+func (a *adminAPI) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		a.controller.SetFrozen(true)
+	case http.MethodDelete:
+		a.controller.SetFrozen(false)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.controller.Status().Freeze)
+}
+
+// handleBindings 处理 GET /admin/bindings，列出所有绑定及其暂停状态
+func (a *adminAPI) handleBindings(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, a.controller.Bindings())
+}
+
+// handlePause 处理 POST /admin/bindings/pause 和 /admin/bindings/resume，请求体为 BindingKey
+func (a *adminAPI) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		var key BindingKey
+		if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := key.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.controller.SetPaused(key, paused); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, BindingStatus{BindingKey: key, Paused: paused})
+	}
+}
+
+// handleResync 处理 POST /admin/resync，请求体为 {"namespace": "...", "deployment": "..."}，同步完成后返回
+func (a *adminAPI) handleResync(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req resyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" || req.Deployment == "" {
+		http.Error(w, "namespace and deployment are required", http.StatusBadRequest)
+		return
+	}
+	if err := a.controller.Resync(req.Namespace, req.Deployment); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// logLevelRequest 是 /admin/log-level 的请求体和响应
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// handleLogLevel 处理 /admin/log-level：GET 查询日志级别，PUT 修改日志级别，请求体为 {"level": "debug"}
+func (a *adminAPI) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := setLogLevel(req.Level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, logLevelRequest{Level: log.GetLevel().String()})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 将控制器返回的错误转换为 HTTP 状态码
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errUnknownBinding) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeAdminController 以真实的冻结开关实现管理接口
+type fakeAdminController struct {
+	fakeReporter
+	freeze   *freezeSwitch
+	paused   *pausedBindings
+	bindings []BindingKey
+	resynced []string
+}
+
+func (f *fakeAdminController) Status() ControllerStatus {
+	return ControllerStatus{Freeze: f.freeze.status()}
+}
+
+func (f *fakeAdminController) SetFrozen(frozen bool) {
+	f.freeze.set(freezeSourceAdmin, frozen)
+}
+
+func (f *fakeAdminController) Bindings() []BindingStatus {
+	var bindings []BindingStatus
+	for _, key := range f.bindings {
+		bindings = append(bindings, BindingStatus{BindingKey: key, Port: 8080, Paused: f.paused.has(key)})
+	}
+	return bindings
+}
+
+func (f *fakeAdminController) SetPaused(key BindingKey, paused bool) error {
+	for _, binding := range f.bindings {
+		if binding == key {
+			_, err := f.paused.set(key, paused)
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", errUnknownBinding, key)
+}
+
+func (f *fakeAdminController) Resync(namespace, deploymentName string) error {
+	if namespace != "default" {
+		return fmt.Errorf("%w: %s/%s", errUnknownBinding, namespace, deploymentName)
+	}
+	f.resynced = append(f.resynced, namespace+"/"+deploymentName)
+	return nil
+}
+
+func TestAdminFreeze(t *testing.T) {
+	controller := &fakeAdminController{freeze: newFreezeSwitch()}
+	server := httptest.NewServer(newHTTPServer("", controller, newAdminAPI("secret", controller)).Handler)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+		wantFrozen bool
+	}{
+		{name: "missing token", method: http.MethodPost, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, token: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "freeze", method: http.MethodPost, token: "secret", wantStatus: http.StatusOK, wantFrozen: true},
+		{name: "query", method: http.MethodGet, token: "secret", wantStatus: http.StatusOK, wantFrozen: true},
+		{name: "unfreeze", method: http.MethodDelete, token: "secret", wantStatus: http.StatusOK},
+		{name: "unsupported method", method: http.MethodPut, token: "secret", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+"/admin/freeze", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var status FreezeStatus
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Frozen != tt.wantFrozen {
+				t.Errorf("frozen = %t, want %t", status.Frozen, tt.wantFrozen)
+			}
+		})
+	}
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	server := httptest.NewServer(newHTTPServer("", fakeReporter{}, nil).Handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/admin/freeze", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestAdminBindings(t *testing.T) {
+	web := BindingKey{Namespace: "default", Deployment: "web", LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-1"}
+	controller := &fakeAdminController{
+		freeze:   newFreezeSwitch(),
+		paused:   newPausedBindings(fake.NewSimpleClientset(), "default", defaultAdminStateConfigMap),
+		bindings: []BindingKey{web},
+	}
+	server := httptest.NewServer(newHTTPServer("", controller, newAdminAPI("secret", controller)).Handler)
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	webJSON := `{"namespace":"default","deployment":"web","load_balancer_id":"lb-00000001","listener_id":"lbl-1","location_id":"loc-1"}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "pause", method: http.MethodPost, path: "/admin/bindings/pause", body: webJSON, wantStatus: http.StatusOK},
+		{name: "pause unknown binding", method: http.MethodPost, path: "/admin/bindings/pause",
+			body: strings.Replace(webJSON, "loc-1", "loc-9", 1), wantStatus: http.StatusNotFound},
+		{name: "pause incomplete binding", method: http.MethodPost, path: "/admin/bindings/pause",
+			body: `{"namespace":"default","deployment":"web"}`, wantStatus: http.StatusBadRequest},
+		{name: "pause invalid body", method: http.MethodPost, path: "/admin/bindings/pause", body: "{", wantStatus: http.StatusBadRequest},
+		{name: "list with GET only", method: http.MethodPost, path: "/admin/bindings", wantStatus: http.StatusMethodNotAllowed},
+		{name: "resync", method: http.MethodPost, path: "/admin/resync", body: `{"namespace":"default","deployment":"web"}`, wantStatus: http.StatusOK},
+		{name: "resync unknown deployment", method: http.MethodPost, path: "/admin/resync",
+			body: `{"namespace":"other","deployment":"web"}`, wantStatus: http.StatusNotFound},
+		{name: "resync without deployment", method: http.MethodPost, path: "/admin/resync", body: `{"namespace":"default"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp := do(tt.method, tt.path, tt.body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+	}
+
+	resp := do(http.MethodGet, "/admin/bindings", "")
+	var bindings []BindingStatus
+	if err := json.NewDecoder(resp.Body).Decode(&bindings); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want := []BindingStatus{{BindingKey: web, Port: 8080, Paused: true}}
+	if !reflect.DeepEqual(bindings, want) {
+		t.Errorf("bindings = %+v, want %+v", bindings, want)
+	}
+	if !reflect.DeepEqual(controller.resynced, []string{"default/web"}) {
+		t.Errorf("resynced = %v, want [default/web]", controller.resynced)
+	}
+
+	resp = do(http.MethodPost, "/admin/bindings/resume", webJSON)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || controller.paused.has(web) {
+		t.Errorf("resume: status = %d, paused = %t", resp.StatusCode, controller.paused.has(web))
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	restoreLogging(t)
+	log.SetLevel(log.InfoLevel)
+
+	controller := &fakeAdminController{freeze: newFreezeSwitch()}
+	server := httptest.NewServer(newHTTPServer("", controller, newAdminAPI("secret", controller)).Handler)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  string
+	}{
+		{name: "query", method: http.MethodGet, wantStatus: http.StatusOK, wantLevel: "info"},
+		{name: "set debug", method: http.MethodPut, body: `{"level":"debug"}`, wantStatus: http.StatusOK, wantLevel: "debug"},
+		{name: "invalid level", method: http.MethodPut, body: `{"level":"verbose"}`, wantStatus: http.StatusBadRequest},
+		{name: "unsupported method", method: http.MethodPost, body: `{"level":"info"}`, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+"/admin/log-level", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var got logLevelRequest
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Level != tt.wantLevel {
+				t.Errorf("level = %s, want %s", got.Level, tt.wantLevel)
+			}
+		})
+	}
+	if got := log.GetLevel(); got != log.DebugLevel {
+		t.Errorf("log level = %s, want debug", got)
+	}
+}
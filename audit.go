@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 审计日志中变更的结果
+const (
+	auditOutcomeSuccess = "success"
+	// 部分后端失败
+	auditOutcomePartial = "partial"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditTarget 是审计日志中的一个后端
+type AuditTarget struct {
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+	// 绑定时为请求的权重（未设置时使用 CLB 默认权重），解绑时为解绑前的权重，修改权重时为新权重
+	Weight *int `json:"weight,omitempty"`
+}
+
+// AuditEntry 是一次负载均衡器变更的审计记录
+type AuditEntry struct {
+	Time           time.Time     `json:"time"`
+	Event          string        `json:"event"`
+	Pod            string        `json:"pod,omitempty"`
+	Namespace      string        `json:"namespace"`
+	Deployment     string        `json:"deployment"`
+	LoadBalancerID string        `json:"load_balancer_id"`
+	ListenerID     string        `json:"listener_id"`
+	LocationID     string        `json:"location_id"`
+	Action         string        `json:"action"`
+	Targets        []AuditTarget `json:"targets"`
+	RequestIDs     []string      `json:"request_ids,omitempty"`
+	Outcome        string        `json:"outcome"`
+	Error          string        `json:"error,omitempty"`
+	DurationMS     int64         `json:"duration_ms"`
+}
+
+// auditTrigger 是触发变更的 Pod 事件
+type auditTrigger struct {
+	event      string
+	pod        string
+	namespace  string
+	deployment string
+}
+
+// auditLogger 以 JSON Lines 格式追加写入审计日志，为 nil 时不记录
+type auditLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// newAuditLoggerFromEnv 读取 AUDIT_LOG：为空时不记录，"-" 或 "stdout" 时写入标准输出，否则追加写入该文件
+func newAuditLoggerFromEnv() (*auditLogger, error) {
+	path := os.Getenv("AUDIT_LOG")
+	switch path {
+	case "":
+		return nil, nil
+	case "-", "stdout":
+		return &auditLogger{out: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %v", path, err)
+	}
+	return &auditLogger{out: file}, nil
+}
+
+// record 写入一次变更的审计记录，start 为开始提交变更的时间
+func (a *auditLogger) record(trigger auditTrigger, target ConfigTarget, kind mutationKind, targets []AuditTarget, requestIDs []string, err error, start time.Time) {
+	if a == nil || len(targets) == 0 {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:           start,
+		Event:          trigger.event,
+		Pod:            trigger.pod,
+		Namespace:      trigger.namespace,
+		Deployment:     trigger.deployment,
+		LoadBalancerID: target.LoadBalancerID,
+		ListenerID:     target.ListenerID,
+		LocationID:     target.LocationID,
+		Action:         auditAction(kind),
+		Targets:        targets,
+		RequestIDs:     requestIDs,
+		Outcome:        auditOutcome(err, len(targets)),
+		DurationMS:     time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		log.Errorf("Failed to encode audit entry: %v", marshalErr)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, writeErr := a.out.Write(append(line, '\n')); writeErr != nil {
+		log.Errorf("Failed to write audit entry: %v", writeErr)
+	}
+}
+
+func auditAction(kind mutationKind) string {
+	switch kind {
+	case mutationRegister:
+		return "register"
+	case mutationModifyWeight:
+		return "modify_weight"
+	}
+	return "deregister"
+}
+
+// auditOutcome 根据错误判断变更的结果，*BatchError 中只有部分后端失败时为 partial
+func auditOutcome(err error, total int) string {
+	if err == nil {
+		return auditOutcomeSuccess
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) && len(batchErr.Failed) < total {
+		return auditOutcomePartial
+	}
+	return auditOutcomeFailure
+}
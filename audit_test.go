@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditLoggerRecord(t *testing.T) {
+	var out bytes.Buffer
+	audit := &auditLogger{out: &out}
+	trigger := auditTrigger{event: "DELETED", pod: "web-1", namespace: "default", deployment: "web"}
+	weight := 10
+
+	audit.record(trigger, testTarget, mutationDeregister,
+		[]AuditTarget{{IP: "10.0.0.1", Port: 8080, Weight: &weight}, {IP: "10.0.0.2", Port: 8080}},
+		[]string{"req-1"},
+		&BatchError{Action: "BatchDeregisterTargets", LoadBalancerID: testTarget.LoadBalancerID, Total: 2,
+			Failed: []FailedTarget{{ListenerID: "lbl-1", LocationID: "loc-1", EniIP: "10.0.0.2", Port: 8080, Err: errors.New("boom")}}},
+		time.Now())
+	audit.record(trigger, testTarget, mutationRegister, []AuditTarget{{IP: "10.0.0.3", Port: 8080}}, []string{"req-2"}, nil, time.Now())
+	// 没有后端时不记录
+	audit.record(trigger, testTarget, mutationModifyWeight, nil, nil, nil, time.Now())
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit lines, want 2:\n%s", len(lines), out.String())
+	}
+
+	var entry AuditEntry
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Event != "DELETED" || entry.Pod != "web-1" || entry.Namespace != "default" || entry.Deployment != "web" ||
+		entry.LoadBalancerID != "lb-00000001" || entry.ListenerID != "lbl-1" || entry.LocationID != "loc-1" {
+		t.Errorf("unexpected trigger or binding: %+v", entry)
+	}
+	if entry.Action != "deregister" || entry.Outcome != auditOutcomePartial || entry.Error == "" {
+		t.Errorf("action = %s, outcome = %s, error = %q", entry.Action, entry.Outcome, entry.Error)
+	}
+	if len(entry.Targets) != 2 || entry.Targets[0].Weight == nil || *entry.Targets[0].Weight != 10 || entry.Targets[1].Weight != nil {
+		t.Errorf("targets = %+v", entry.Targets)
+	}
+	if len(entry.RequestIDs) != 1 || entry.RequestIDs[0] != "req-1" {
+		t.Errorf("request_ids = %v", entry.RequestIDs)
+	}
+
+	entry = AuditEntry{}
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Action != "register" || entry.Outcome != auditOutcomeSuccess || entry.Error != "" {
+		t.Errorf("action = %s, outcome = %s, error = %q", entry.Action, entry.Outcome, entry.Error)
+	}
+}
+
+func TestAuditOutcome(t *testing.T) {
+	failed := []FailedTarget{{EniIP: "10.0.0.1"}}
+	tests := []struct {
+		name  string
+		err   error
+		total int
+		want  string
+	}{
+		{name: "success", total: 2, want: auditOutcomeSuccess},
+		{name: "partial", err: &BatchError{Failed: failed}, total: 2, want: auditOutcomePartial},
+		{name: "all targets failed", err: &BatchError{Failed: failed}, total: 1, want: auditOutcomeFailure},
+		{name: "other error", err: errors.New("no client for region"), total: 2, want: auditOutcomeFailure},
+	}
+
+	for _, tt := range tests {
+		if got := auditOutcome(tt.err, tt.total); got != tt.want {
+			t.Errorf("%s: auditOutcome() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNilAuditLogger(t *testing.T) {
+	var audit *auditLogger
+	audit.record(auditTrigger{}, testTarget, mutationRegister, []AuditTarget{{IP: "10.0.0.1", Port: 8080}}, nil, nil, time.Now())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+// 单次批量绑定/解绑的后端数量上限（CLB API 限制为 500）
+const maxBatchTargets = 500
+
+// FailedTarget 描述一个绑定/解绑失败的后端
+type FailedTarget struct {
+	ListenerID string
+	LocationID string
+	EniIP      string
+	Port       int
+	Err        error
+}
+
+// BatchError 汇总分批请求中所有失败的后端
+type BatchError struct {
+	Action         string
+	LoadBalancerID string
+	Total          int
+	Failed         []FailedTarget
+}
+
+func (e *BatchError) Error() string {
+	var parts []string
+	for _, f := range e.Failed {
+		target := fmt.Sprintf("%s:%d", f.EniIP, f.Port)
+		if f.LocationID != "" {
+			target = fmt.Sprintf("%s/%s/%s", f.ListenerID, f.LocationID, target)
+		} else {
+			target = fmt.Sprintf("%s/%s", f.ListenerID, target)
+		}
+		parts = append(parts, fmt.Sprintf("%s (%v)", target, f.Err))
+	}
+	return fmt.Sprintf("%s on %s failed for %d/%d targets: %s",
+		e.Action, e.LoadBalancerID, len(e.Failed), e.Total, strings.Join(parts, "; "))
+}
+
+// batchCall 发送一批后端，返回 CLB 报告失败的监听器 ID 以及用于查询异步任务的 RequestId
+type batchCall func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error)
+
+func newBatchTarget(listenerID, locationID, eniIP string, port int) *clb.BatchTarget {
+	target := &clb.BatchTarget{
+		ListenerId: common.StringPtr(listenerID),
+		Port:       common.Int64Ptr(int64(port)),
+		EniIp:      common.StringPtr(eniIP),
+	}
+	if locationID != "" {
+		target.LocationId = common.StringPtr(locationID)
+	}
+	return target
+}
+
+// chunkBatchTargets 按 size 将后端切分为多批
+func chunkBatchTargets(targets []*clb.BatchTarget, size int) [][]*clb.BatchTarget {
+	var chunks [][]*clb.BatchTarget
+	for size < len(targets) {
+		chunks = append(chunks, targets[:size:size])
+		targets = targets[size:]
+	}
+	if len(targets) > 0 {
+		chunks = append(chunks, targets)
+	}
+	return chunks
+}
+
+// runBatches 分批依次执行 call（每批按重试策略重试并等待异步任务完成），
+// 返回所有批次的 RequestId，并将失败的后端汇总为 *BatchError。
+// CLB 不允许并发修改同一实例，因此同一负载均衡器的各批次不并发发送
+func (tc *TencentClient) runBatches(action, loadBalancerID string, targets []*clb.BatchTarget, call batchCall) ([]string, error) {
+	var (
+		failed     []FailedTarget
+		requestIDs []string
+	)
+	for _, chunk := range chunkBatchTargets(targets, tc.batchSize) {
+		chunkFailed := collectFailedTargets(chunk, func(chunk []*clb.BatchTarget) ([]*string, error) {
+			var failListenerIDs []*string
+			var requestID string
+			err := tc.call(action, func(ctx context.Context) error {
+				var err error
+				failListenerIDs, requestID, err = call(ctx, chunk)
+				return err
+			})
+			if requestID != "" {
+				requestIDs = append(requestIDs, requestID)
+			}
+			if err == nil && requestID != "" {
+				err = tc.waitForTask(requestID)
+			}
+			return failListenerIDs, err
+		})
+		failed = append(failed, chunkFailed...)
+	}
+
+	sort.Strings(requestIDs)
+	if len(failed) == 0 {
+		return requestIDs, nil
+	}
+	return requestIDs, &BatchError{
+		Action:         action,
+		LoadBalancerID: loadBalancerID,
+		Total:          len(targets),
+		Failed:         failed,
+	}
+}
+
+func collectFailedTargets(chunk []*clb.BatchTarget, call func([]*clb.BatchTarget) ([]*string, error)) []FailedTarget {
+	failListenerIDs, err := call(chunk)
+
+	failSet := make(map[string]struct{}, len(failListenerIDs))
+	for _, id := range failListenerIDs {
+		if id != nil {
+			failSet[*id] = struct{}{}
+		}
+	}
+
+	var failed []FailedTarget
+	for _, target := range chunk {
+		targetErr := err
+		if targetErr == nil {
+			if _, found := failSet[*target.ListenerId]; !found {
+				continue
+			}
+			targetErr = fmt.Errorf("listener %s reported as failed", *target.ListenerId)
+		}
+
+		f := FailedTarget{
+			ListenerID: *target.ListenerId,
+			EniIP:      *target.EniIp,
+			Port:       int(*target.Port),
+			Err:        targetErr,
+		}
+		if target.LocationId != nil {
+			f.LocationID = *target.LocationId
+		}
+		failed = append(failed, f)
+	}
+	return failed
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+func makeBatchTargets(n int, listenerID string) []*clb.BatchTarget {
+	var targets []*clb.BatchTarget
+	for i := 0; i < n; i++ {
+		targets = append(targets, newBatchTarget(listenerID, "loc-1", fmt.Sprintf("10.0.0.%d", i), 80))
+	}
+	return targets
+}
+
+func TestChunkBatchTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     int
+		size  int
+		sizes []int
+	}{
+		{name: "empty", n: 0, size: 500, sizes: nil},
+		{name: "single chunk", n: 3, size: 500, sizes: []int{3}},
+		{name: "exact multiple", n: 4, size: 2, sizes: []int{2, 2}},
+		{name: "remainder", n: 5, size: 2, sizes: []int{2, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkBatchTargets(makeBatchTargets(tt.n, "lbl-1"), tt.size)
+			if len(chunks) != len(tt.sizes) {
+				t.Fatalf("chunkBatchTargets() returned %d chunks, want %d", len(chunks), len(tt.sizes))
+			}
+			for i, chunk := range chunks {
+				if len(chunk) != tt.sizes[i] {
+					t.Errorf("chunk %d has %d targets, want %d", i, len(chunk), tt.sizes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	tc := &TencentClient{batchSize: 2, retry: testRetryPolicy, limiter: newAPIRateLimiter(rateLimit{}, nil)}
+
+	var inFlight int32
+	calls := 0
+	targets := append(makeBatchTargets(3, "lbl-ok"), makeBatchTargets(1, "lbl-bad")...)
+	requestIDs, err := tc.runBatches("BatchRegisterTargets", "lb-1", targets, func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error) {
+		if atomic.AddInt32(&inFlight, 1) > 1 {
+			t.Errorf("chunks of one load balancer should not be sent concurrently")
+		}
+		defer atomic.AddInt32(&inFlight, -1)
+		calls++
+		if len(chunk) > 2 {
+			t.Errorf("chunk of %d targets exceeds batch size", len(chunk))
+		}
+		for _, target := range chunk {
+			if *target.ListenerId == "lbl-bad" {
+				return []*string{common.StringPtr("lbl-bad")}, "", nil
+			}
+		}
+		return nil, "", nil
+	})
+
+	if calls != 2 {
+		t.Errorf("call invoked %d times, want 2", calls)
+	}
+	if len(requestIDs) != 0 {
+		t.Errorf("requestIDs = %v, want none", requestIDs)
+	}
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("runBatches() error = %v, want *BatchError", err)
+	}
+	if batchErr.Total != 4 || len(batchErr.Failed) != 1 || batchErr.Failed[0].ListenerID != "lbl-bad" {
+		t.Errorf("unexpected BatchError: %+v", batchErr)
+	}
+	if !strings.Contains(batchErr.Error(), "lbl-bad/loc-1/10.0.0.0:80") {
+		t.Errorf("Error() = %q, should name the failed target", batchErr.Error())
+	}
+}
+
+func TestRunBatchesCallError(t *testing.T) {
+	tc := &TencentClient{batchSize: 2, retry: testRetryPolicy, limiter: newAPIRateLimiter(rateLimit{}, nil)}
+
+	_, err := tc.runBatches("BatchDeregisterTargets", "lb-1", makeBatchTargets(3, "lbl-1"), func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error) {
+		if len(chunk) == 1 {
+			return nil, "", fmt.Errorf("boom")
+		}
+		return nil, "", nil
+	})
+
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("runBatches() error = %v, want *BatchError", err)
+	}
+	if len(batchErr.Failed) != 1 || batchErr.Failed[0].EniIP != "10.0.0.2" {
+		t.Errorf("unexpected failed targets: %+v", batchErr.Failed)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认的解绑预算时间窗口
+	defaultDeregistrationBudgetWindow = time.Minute
+	// 检查排队中的解绑的间隔
+	deregistrationBudgetInterval = 5 * time.Second
+)
+
+// tokenBucket 是容量为 capacity、每个 window 补满一次的令牌桶
+type tokenBucket struct {
+	capacity int
+	window   time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, window time.Duration, now time.Time) *tokenBucket {
+	return &tokenBucket{capacity: capacity, window: window, tokens: float64(capacity), last: now}
+}
+
+// available 按经过的时间补充令牌，返回当前可用的整数令牌数
+func (b *tokenBucket) available(now time.Time) int {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(b.capacity) * float64(elapsed) / float64(b.window)
+		if b.tokens > float64(b.capacity) {
+			b.tokens = float64(b.capacity)
+		}
+		b.last = now
+	}
+	return int(b.tokens)
+}
+
+func (b *tokenBucket) consume(n int) {
+	b.tokens -= float64(n)
+}
+
+// queuedDeregistration 是某个转发规则上因预算不足而排队的解绑
+type queuedDeregistration struct {
+	// 后端所属的 namespace/deployment
+	deployment     string
+	loadBalancerID string
+	backends       []string
+	queuedAt       time.Time
+}
+
+// deregistrationBudget 限制每个时间窗口内全局和每个负载均衡器的解绑数量，
+// 并记录超出预算、等待预算恢复后再解绑的后端
+type deregistrationBudget struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	window time.Duration
+	// 全局和每个负载均衡器每个窗口的解绑数量上限，0 表示不限制
+	globalLimit int
+	perLBLimit  int
+	global      *tokenBucket
+	lbs         map[string]*tokenBucket
+	queued      map[string]queuedDeregistration
+}
+
+func newDeregistrationBudget(globalLimit, perLBLimit int, window time.Duration) *deregistrationBudget {
+	return &deregistrationBudget{
+		now:         time.Now,
+		window:      window,
+		globalLimit: globalLimit,
+		perLBLimit:  perLBLimit,
+		lbs:         make(map[string]*tokenBucket),
+		queued:      make(map[string]queuedDeregistration),
+	}
+}
+
+// deregistrationBudgetFromEnv 读取 DEREGISTRATION_BUDGET、DEREGISTRATION_BUDGET_PER_LB
+// 和 DEREGISTRATION_BUDGET_WINDOW
+func deregistrationBudgetFromEnv() (*deregistrationBudget, error) {
+	globalLimit, err := envInt("DEREGISTRATION_BUDGET", 0)
+	if err != nil {
+		return nil, err
+	}
+	perLBLimit, err := envInt("DEREGISTRATION_BUDGET_PER_LB", 0)
+	if err != nil {
+		return nil, err
+	}
+	window, err := envDuration("DEREGISTRATION_BUDGET_WINDOW", defaultDeregistrationBudgetWindow)
+	if err != nil {
+		return nil, err
+	}
+	if globalLimit < 0 || perLBLimit < 0 {
+		return nil, fmt.Errorf("DEREGISTRATION_BUDGET and DEREGISTRATION_BUDGET_PER_LB must not be negative")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("DEREGISTRATION_BUDGET_WINDOW must be greater than 0")
+	}
+	return newDeregistrationBudget(globalLimit, perLBLimit, window), nil
+}
+
+// take 从全局和负载均衡器的预算中扣除最多 n 次解绑，返回允许执行的数量
+func (b *deregistrationBudget) take(loadBalancerID string, n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	allowed := n
+	if b.globalLimit > 0 {
+		if b.global == nil {
+			b.global = newTokenBucket(b.globalLimit, b.window, now)
+		}
+		allowed = min(allowed, b.global.available(now))
+	}
+	var lb *tokenBucket
+	if b.perLBLimit > 0 {
+		lb = b.lbs[loadBalancerID]
+		if lb == nil {
+			lb = newTokenBucket(b.perLBLimit, b.window, now)
+			b.lbs[loadBalancerID] = lb
+		}
+		allowed = min(allowed, lb.available(now))
+	}
+	if allowed <= 0 {
+		return 0
+	}
+	if b.global != nil {
+		b.global.consume(allowed)
+	}
+	if lb != nil {
+		lb.consume(allowed)
+	}
+	return allowed
+}
+
+func queuedKey(target ConfigTarget) string {
+	return fmt.Sprintf("%s/%s/%s:%d", target.LoadBalancerID, target.ListenerID, target.LocationID, target.Port)
+}
+
+// queue 记录转发规则上排队等待解绑的后端，backends 为空时清除记录
+func (b *deregistrationBudget) queue(target ConfigTarget, deployment string, backends []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := queuedKey(target)
+	if len(backends) == 0 {
+		if _, ok := b.queued[key]; !ok {
+			return
+		}
+		delete(b.queued, key)
+	} else {
+		b.queued[key] = queuedDeregistration{
+			deployment:     deployment,
+			loadBalancerID: target.LoadBalancerID,
+			backends:       backends,
+			queuedAt:       b.now(),
+		}
+	}
+	b.updateMetricLocked(target.LoadBalancerID)
+}
+
+// pending 返回有排队中的解绑的 Deployment 和当前时间。调用方随后同步这些 Deployment，
+// 仍超出预算的解绑会重新排队，同步成功后用返回的时间调用 prune
+func (b *deregistrationBudget) pending() ([]string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var deployments []string
+	for _, entry := range b.queued {
+		if _, ok := seen[entry.deployment]; !ok {
+			seen[entry.deployment] = struct{}{}
+			deployments = append(deployments, entry.deployment)
+		}
+	}
+	sort.Strings(deployments)
+	return deployments, b.now()
+}
+
+// prune 清除 Deployment 在 before 及之前排队、同步后未再排队的记录，
+// 例如规则中已删除的绑定
+func (b *deregistrationBudget) prune(deployment string, before time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, entry := range b.queued {
+		if entry.deployment == deployment && !entry.queuedAt.After(before) {
+			delete(b.queued, key)
+			b.updateMetricLocked(entry.loadBalancerID)
+		}
+	}
+}
+
+func (b *deregistrationBudget) updateMetricLocked(loadBalancerID string) {
+	count := 0
+	for _, entry := range b.queued {
+		if entry.loadBalancerID == loadBalancerID {
+			count += len(entry.backends)
+		}
+	}
+	deregistrationsQueued.WithLabelValues(loadBalancerID).Set(float64(count))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeregistrationBudgetTake(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	budget := newDeregistrationBudget(5, 3, time.Minute)
+	budget.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		lb      string
+		n       int
+		want    int
+	}{
+		{name: "within per-LB budget", lb: "lb-1", n: 2, want: 2},
+		{name: "capped by per-LB budget", lb: "lb-1", n: 5, want: 1},
+		{name: "per-LB budget exhausted", lb: "lb-1", n: 1, want: 0},
+		{name: "capped by global budget", lb: "lb-2", n: 3, want: 2},
+		{name: "global budget exhausted", lb: "lb-3", n: 1, want: 0},
+		{name: "partially refilled", advance: 24 * time.Second, lb: "lb-2", n: 3, want: 2},
+		{name: "fully refilled", advance: time.Hour, lb: "lb-1", n: 10, want: 3},
+		{name: "nothing to remove", lb: "lb-2", n: 0, want: 0},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if got := budget.take(step.lb, step.n); got != step.want {
+			t.Errorf("%s: take(%s, %d) = %d, want %d", step.name, step.lb, step.n, got, step.want)
+		}
+	}
+}
+
+func TestDeregistrationBudgetUnlimited(t *testing.T) {
+	budget := newDeregistrationBudget(0, 0, time.Minute)
+	if got := budget.take("lb-1", 1000); got != 1000 {
+		t.Errorf("take() = %d, want 1000", got)
+	}
+}
+
+func TestDeregistrationBudgetQueue(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	budget := newDeregistrationBudget(1, 0, time.Minute)
+	budget.now = func() time.Time { return now }
+
+	other := testTarget
+	other.LocationID = "loc-2"
+	budget.queue(testTarget, "default/web", []string{"10.0.0.1:8080"})
+	budget.queue(other, "default/web", []string{"10.0.0.2:8080"})
+	budget.queue(ConfigTarget{LoadBalancerID: "lb-2", Port: 80}, "default/api", []string{"10.0.0.3:80"})
+
+	deployments, synced := budget.pending()
+	if want := []string{"default/api", "default/web"}; !reflect.DeepEqual(deployments, want) {
+		t.Fatalf("pending() = %v, want %v", deployments, want)
+	}
+
+	// 同步后仍有一个绑定需要排队，另一个已从规则中删除
+	now = now.Add(time.Second)
+	budget.queue(testTarget, "default/web", []string{"10.0.0.1:8080"})
+	budget.prune("default/web", synced)
+	// 解绑完成后清除记录
+	budget.queue(ConfigTarget{LoadBalancerID: "lb-2", Port: 80}, "default/api", nil)
+
+	deployments, _ = budget.pending()
+	if want := []string{"default/web"}; !reflect.DeepEqual(deployments, want) {
+		t.Fatalf("pending() after prune = %v, want %v", deployments, want)
+	}
+	if len(budget.queued) != 1 {
+		t.Errorf("queued = %v, want only %s", budget.queued, queuedKey(testTarget))
+	}
+}
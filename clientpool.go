@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+// 默认区域
+const defaultRegion = "ap-beijing"
+
+// TencentClientPool 按区域和凭证配置维护 CLB 客户端，并将每个负载均衡器的调用
+// 路由到 rules.yaml 中为其指定的区域和账号
+type TencentClientPool struct {
+	// 凭证后台刷新的生命周期
+	ctx           context.Context
+	mu            sync.Mutex
+	settings      tencentSettings
+	limits        clientLimits
+	defaultRegion string
+	// 凭证配置名到凭证的映射，"" 为默认凭证链
+	credentials map[string]common.CredentialIface
+	// "区域/凭证配置" 到客户端的映射
+	clients map[string]*TencentClient
+	// 负载均衡器 ID 到客户端的映射
+	routes map[string]*TencentClient
+}
+
+func NewTencentClientPool(ctx context.Context) (*TencentClientPool, error) {
+	region := os.Getenv("TENCENT_REGION")
+	if region == "" {
+		region = defaultRegion
+	}
+
+	settings, err := newTencentSettingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// 按凭证链获取默认凭证，临时凭证会在过期前自动刷新
+	credential, err := newCredentialFromEnv(ctx, region, settings.stsEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tencent credential: %v", err)
+	}
+
+	return newTencentClientPool(ctx, region, settings, credential), nil
+}
+
+func newTencentClientPool(ctx context.Context, region string, settings tencentSettings, credential common.CredentialIface) *TencentClientPool {
+	return &TencentClientPool{
+		ctx:           ctx,
+		settings:      settings,
+		limits:        newClientLimits(settings),
+		defaultRegion: region,
+		credentials:   map[string]common.CredentialIface{"": credential},
+		clients:       make(map[string]*TencentClient),
+		routes:        make(map[string]*TencentClient),
+	}
+}
+
+// clientLimits 是池中所有客户端共享的限制：CLB API 配额按账号计算，
+// 因此各区域和凭证配置的客户端共用一组令牌桶和同时变更的负载均衡器数量，而不是各自拥有完整的配额
+type clientLimits struct {
+	limiter *apiRateLimiter
+	lbSlots chan struct{}
+}
+
+func newClientLimits(settings tencentSettings) clientLimits {
+	return clientLimits{
+		limiter: newAPIRateLimiter(settings.defaultRateLimit, settings.rateLimits),
+		lbSlots: make(chan struct{}, settings.maxParallelLBs),
+	}
+}
+
+// Client 返回指定区域和凭证配置的客户端，region 为空时使用默认区域，profile 为空时使用默认凭证
+func (p *TencentClientPool) Client(region, profile string) (*TencentClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.client(region, profile)
+}
+
+func (p *TencentClientPool) client(region, profile string) (*TencentClient, error) {
+	if region == "" {
+		region = p.defaultRegion
+	}
+
+	key := region + "/" + profile
+	if tc, ok := p.clients[key]; ok {
+		return tc, nil
+	}
+
+	credential, ok := p.credentials[profile]
+	if !ok {
+		var err error
+		credential, err = newProfileCredential(p.ctx, profile, region, p.settings.stsEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credential profile %q: %v", profile, err)
+		}
+		p.credentials[profile] = credential
+	}
+
+	tc, err := newTencentClient(region, credential, p.settings, p.limits)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = tc
+	log.Infof("Created CLB client for region %s, credential profile %q", region, profile)
+	return tc, nil
+}
+
+// Route 指定负载均衡器使用的区域和凭证配置
+func (p *TencentClientPool) Route(loadBalancerID, region, profile string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tc, err := p.client(region, profile)
+	if err != nil {
+		return err
+	}
+	p.routes[loadBalancerID] = tc
+	return nil
+}
+
+// ForLB 返回负载均衡器对应的客户端，未指定路由时使用默认区域和凭证
+func (p *TencentClientPool) ForLB(loadBalancerID string) (*TencentClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if tc, ok := p.routes[loadBalancerID]; ok {
+		return tc, nil
+	}
+	return p.client("", "")
+}
+
+func (p *TencentClientPool) BatchRegisterTargets(loadBalancerID string, targets []RegisterTarget) ([]string, error) {
+	tc, err := p.ForLB(loadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	return tc.BatchRegisterTargets(loadBalancerID, targets)
+}
+
+func (p *TencentClientPool) BatchDeregisterTargets(loadBalancerID string, targets []DeregisterTarget) ([]string, error) {
+	tc, err := p.ForLB(loadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	return tc.BatchDeregisterTargets(loadBalancerID, targets)
+}
+
+func (p *TencentClientPool) BatchModifyTargetWeight(loadBalancerID string, targets []WeightTarget) ([]string, error) {
+	tc, err := p.ForLB(loadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	return tc.BatchModifyTargetWeight(loadBalancerID, targets)
+}
+
+func (p *TencentClientPool) DescribeTargets(loadBalancerID string, listenerIDs []string) (*DescribeTargetsResponse, error) {
+	tc, err := p.ForLB(loadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	return tc.DescribeTargets(loadBalancerID, listenerIDs)
+}
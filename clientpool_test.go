@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+func newTestClientPool() *TencentClientPool {
+	return newTencentClientPool(context.Background(), "ap-beijing", tencentSettings{
+		batchSize:      maxBatchTargets,
+		retry:          testRetryPolicy,
+		maxParallelLBs: 1,
+	}, common.NewCredential("id", "key"))
+}
+
+func TestTencentClientPoolRoutes(t *testing.T) {
+	pool := newTestClientPool()
+
+	if err := pool.Route("lb-gz", "ap-guangzhou", ""); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if err := pool.Route("lb-gz-2", "ap-guangzhou", ""); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	gz, _ := pool.ForLB("lb-gz")
+	gz2, _ := pool.ForLB("lb-gz-2")
+	if gz.region != "ap-guangzhou" || gz != gz2 {
+		t.Errorf("LBs in the same region and profile should share one client")
+	}
+
+	def, err := pool.ForLB("lb-unrouted")
+	if err != nil || def.region != "ap-beijing" {
+		t.Errorf("unrouted LB should use the default region, got %v, %v", def, err)
+	}
+	if def.limiter != gz.limiter || def.queue.sem != gz.queue.sem {
+		t.Errorf("clients in different regions should share the rate limiter and load balancer slots")
+	}
+}
+
+func TestTencentClientPoolProfiles(t *testing.T) {
+	pool := newTestClientPool()
+
+	t.Setenv("CLOUD_TENCENT_PROFILES_DIR", "")
+	if err := pool.Route("lb-1", "ap-shanghai", "other-account"); err == nil {
+		t.Error("Route() should fail when CLOUD_TENCENT_PROFILES_DIR is not set")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("CLOUD_TENCENT_PROFILES_DIR", dir)
+	profileDir := filepath.Join(dir, "other-account")
+	os.Mkdir(profileDir, 0700)
+	os.WriteFile(filepath.Join(profileDir, "secret-id"), []byte("other-id"), 0600)
+	os.WriteFile(filepath.Join(profileDir, "secret-key"), []byte("other-key"), 0600)
+
+	if err := pool.Route("lb-1", "ap-shanghai", "other-account"); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if got := pool.credentials["other-account"].GetSecretId(); got != "other-id" {
+		t.Errorf("profile credential secret id = %q, want other-id", got)
+	}
+	if err := pool.Route("lb-2", "ap-shanghai", "../escape"); err == nil {
+		t.Error("Route() should reject profile names containing path separators")
+	}
+}
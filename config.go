@@ -1,22 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 )
 
+const (
+	// 默认规则文件路径
+	defaultRulesPath = "rules.yaml"
+	// 默认的规则重新加载间隔
+	defaultRulesReloadInterval = 60 * time.Second
+)
+
+// Config 将期望配置（解析后的规则）与实际状态（负载均衡器的监听器、转发规则和后端）
+// 分开维护，两者由 RunRefresh 在后台各自按间隔刷新，targets 由两者合并得到。
+// 同步只读取当前的快照，不等待规则加载或 CLB 查询
 type Config struct {
-	targets  map[string][]ConfigTarget
-	backends map[string][]Backend
-	mu       sync.RWMutex
-	lastLoad time.Time
-	tencent  *TencentClient
+	source        rulesSource
+	version       string
+	rules         []RuleConfig
+	rulesByFile   map[string][]RuleConfig
+	files         []RulesFileStatus
+	conflicts     []RuleConflict
+	rulesLoadedAt time.Time
+	// 各负载均衡器和转发规则的归属文件，用于解决文件之间的冲突。
+	// ownersStore 不为 nil 时归属保存在状态 ConfigMap 中，savedOwners 为最近一次保存的归属
+	owners      *ruleOwners
+	ownersStore *ruleOwnersStore
+	savedOwners *ruleOwners
+
+	state *clbState
+
+	rulesInterval time.Duration
+	stateInterval time.Duration
+
+	targets    map[string][]ConfigTarget
+	unresolved []UnresolvedRule
+	mu         sync.RWMutex
+	// 串行执行规则加载和状态刷新，同步不获取该锁
+	refreshMu sync.Mutex
+	tencent   *TencentClientPool
 }
 
 type ConfigTarget struct {
@@ -24,6 +55,26 @@ type ConfigTarget struct {
 	ListenerID     string
 	LocationID     string
 	Port           int
+	// 规则中配置的后端权重，为 nil 时不管理权重
+	Weight *int
+	// 新绑定的 Pod 的慢启动时长，为 0 时直接使用完整权重
+	SlowStart time.Duration
+	// 解绑后端时的安全限制
+	Safety SafetyConfig
+	// 转发规则在多个 Deployment 之间按比例分配流量时的所有后端，否则为 nil
+	Split []SplitMember
+}
+
+// SplitMember 是按比例分配流量的转发规则中的一个后端
+type SplitMember struct {
+	Namespace  string
+	Deployment string
+	Port       int
+	Share      int
+}
+
+func (m SplitMember) key() string {
+	return fmt.Sprintf("%s/%s", m.Namespace, m.Deployment)
 }
 
 type Backend struct {
@@ -33,130 +84,384 @@ type Backend struct {
 
 type RuleConfig struct {
 	LoadBalancerID string `yaml:"load_balancer_id"`
-	Listeners      []struct {
-		Port     int    `yaml:"port"`
-		Protocol string `yaml:"protocol"`
-		Rules    []struct {
-			Domain  string `yaml:"domain"`
-			URL     string `yaml:"url"`
-			Backend struct {
-				Namespace  string `yaml:"namespace"`
-				Deployment string `yaml:"deployment"`
-				Port       int    `yaml:"port"`
-			} `yaml:"backend"`
-		} `yaml:"rules"`
-	} `yaml:"listeners"`
-}
-
-func LoadConfig() (*Config, error) {
-	tencent, err := NewTencentClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create tencent client: %v", err)
+	// 负载均衡器所在区域，为空时使用 TENCENT_REGION
+	Region string `yaml:"region"`
+	// 凭证配置名，为空时使用默认凭证
+	CredentialProfile string           `yaml:"credential_profile"`
+	Listeners         []ListenerConfig `yaml:"listeners"`
+
+	// 规则所在的文件
+	file string
+}
+
+type ListenerConfig struct {
+	Port     int                  `yaml:"port"`
+	Protocol string               `yaml:"protocol"`
+	Rules    []ListenerRuleConfig `yaml:"rules"`
+}
+
+type ListenerRuleConfig struct {
+	Domain  string        `yaml:"domain"`
+	URL     string        `yaml:"url"`
+	Backend BackendConfig `yaml:"backend,omitempty"`
+	// 按比例分配流量的多个后端，与 Backend 二选一
+	Backends []SplitBackendConfig `yaml:"backends,omitempty"`
+}
+
+// SplitBackendConfig 是按比例分配流量的后端，Share 为该后端分到的流量百分比
+type SplitBackendConfig struct {
+	BackendConfig `yaml:",inline"`
+	Share         int `yaml:"share"`
+}
+
+// members 返回转发规则的所有后端，只有一个后端时 Share 为 0
+func (r ListenerRuleConfig) members() []SplitBackendConfig {
+	if len(r.Backends) > 0 {
+		return r.Backends
 	}
+	return []SplitBackendConfig{{BackendConfig: r.Backend}}
+}
+
+type BackendConfig struct {
+	Namespace  string `yaml:"namespace"`
+	Deployment string `yaml:"deployment"`
+	Port       int    `yaml:"port"`
+	// 后端权重（0-100），可被 Pod 的 clb.tencent/weight 注解覆盖，未设置时使用 CLB 默认权重
+	Weight *int `yaml:"weight,omitempty"`
+	// 慢启动时长，新绑定的 Pod 在此期间内从低权重逐步提高到完整权重
+	SlowStart time.Duration `yaml:"slow_start,omitempty"`
+	// 解绑后端时的安全限制
+	Safety SafetyConfig `yaml:"safety,omitempty"`
+}
 
+func LoadConfig(tencent *TencentClientPool, source rulesSource, ownersStore *ruleOwnersStore) (*Config, error) {
 	config := &Config{
-		targets:  make(map[string][]ConfigTarget),
-		backends: make(map[string][]Backend),
-		tencent:  tencent,
+		source:      source,
+		targets:     make(map[string][]ConfigTarget),
+		tencent:     tencent,
+		ownersStore: ownersStore,
 	}
+	config.state = newCLBState(config.getListeners)
 
-	err = config.loadConfig()
-	if err != nil {
+	var err error
+	if config.rulesInterval, err = envDuration("RULES_RELOAD_INTERVAL", defaultRulesReloadInterval); err != nil {
 		return nil, err
 	}
+	if config.stateInterval, err = envDuration("CLB_STATE_REFRESH_INTERVAL", defaultStateRefreshInterval); err != nil {
+		return nil, err
+	}
+	if config.rulesInterval <= 0 || config.stateInterval <= 0 {
+		return nil, fmt.Errorf("RULES_RELOAD_INTERVAL and CLB_STATE_REFRESH_INTERVAL must be greater than 0")
+	}
+
+	// 读取重启前的归属，读取失败时按没有归属记录处理
+	if ownersStore != nil {
+		owners, err := ownersStore.load()
+		if err != nil {
+			log.Warnf("Failed to load rule owners, resolving conflicts by file order: %v", err)
+		}
+		config.owners = owners
+		config.savedOwners = owners
+	}
+
+	config.refreshMu.Lock()
+	defer config.refreshMu.Unlock()
+
+	// 部分规则文件无效时仍然启动，全部无效时退出
+	if err := config.loadRules(); err != nil && len(config.rules) == 0 {
+		return nil, err
+	}
+	config.refreshState()
 
 	return config, nil
 }
 
-func (c *Config) loadConfig() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// loadRules 读取并解析所有规则文件，合并后为新出现的负载均衡器获取状态，然后重新计算 targets。
+// 读取失败时保留之前的全部规则；某个文件无效时沿用该文件上一次成功解析的规则，
+// 其余文件照常生效，并返回无效文件的错误。调用方需持有 refreshMu
+func (c *Config) loadRules() error {
+	docs, version, err := c.source.read()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", c.source, err)
+	}
+
+	c.mu.RLock()
+	previous := c.rulesByFile
+	owners := c.owners
+	c.mu.RUnlock()
+
+	var (
+		files    []rulesFile
+		statuses []RulesFileStatus
+		errs     []error
+	)
+	byFile := make(map[string][]RuleConfig)
+	for _, doc := range docs {
+		status := RulesFileStatus{Name: doc.name}
+		rules, err := parseRules(doc.data)
+		if err != nil {
+			log.Errorf("Invalid rules in %s, keeping its previous rules: %v", doc.name, err)
+			errs = append(errs, fmt.Errorf("invalid rules in %s: %v", doc.name, err))
+			status.Error = err.Error()
+			rules = previous[doc.name]
+		}
+		for _, rule := range rules {
+			for _, listener := range rule.Listeners {
+				status.Bindings += len(listener.Rules)
+			}
+		}
+		if rules != nil {
+			byFile[doc.name] = rules
+			files = append(files, rulesFile{name: doc.name, rules: rules})
+		}
+		statuses = append(statuses, status)
+	}
 
-	// 检查缓存是否过期（60秒）
-	if time.Since(c.lastLoad) < 60*time.Second {
-		return nil
+	rules, conflicts, owners := mergeRules(files, owners)
+	// 保存变化后的归属，保存失败时在下次加载规则时重试
+	if c.ownersStore != nil && !reflect.DeepEqual(owners, c.savedOwners) {
+		if err := c.ownersStore.save(owners); err != nil {
+			log.Errorf("Failed to save rule owners: %v", err)
+		} else {
+			c.savedOwners = owners
+		}
 	}
+	log.Infof("Loaded configs: %v", rules)
 
-	// 读取配置文件
-	data, err := ioutil.ReadFile("rules.yaml")
-	if err != nil {
-		return fmt.Errorf("failed to read rules.yaml: %v", err)
+	// 将负载均衡器的调用路由到对应区域和账号的客户端，合并后同一负载均衡器的区域和凭证一致
+	var ids []string
+	routed := make(map[string]struct{})
+	for _, rule := range rules {
+		if _, ok := routed[rule.LoadBalancerID]; ok {
+			continue
+		}
+		routed[rule.LoadBalancerID] = struct{}{}
+		err := c.tencent.Route(rule.LoadBalancerID, rule.Region, rule.CredentialProfile)
+		if err != nil {
+			log.Errorf("Failed to create client for LB %s: %v", rule.LoadBalancerID, err)
+			continue
+		}
+		ids = append(ids, rule.LoadBalancerID)
 	}
 
-	var configs []RuleConfig
-	err = yaml.Unmarshal(data, &configs)
-	if err != nil {
-		return fmt.Errorf("failed to parse rules.yaml: %v", err)
+	// 只为尚无快照的负载均衡器获取状态，其余的按状态刷新间隔更新
+	c.state.retain(ids)
+	c.state.refresh(c.state.missing(ids))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		log.Infof("Applied rules from %s, version %s", c.source, version)
+		rulesInfo.Reset()
+		rulesInfo.WithLabelValues(c.source.String(), version).Set(1)
+	}
+	if !reflect.DeepEqual(conflicts, c.conflicts) {
+		for _, conflict := range conflicts {
+			log.Warnf("Conflicting rule ignored: %s", conflict)
+		}
 	}
+	ruleConflicts.Set(float64(len(conflicts)))
+	invalidRulesFiles.Set(float64(len(errs)))
+
+	c.rules = rules
+	c.rulesByFile = byFile
+	c.files = statuses
+	c.conflicts = conflicts
+	c.owners = owners
+	c.version = version
+	c.rulesLoadedAt = time.Now()
+	rulesLastReloadTimestamp.Set(float64(c.rulesLoadedAt.Unix()))
+
+	c.setTargets(buildTargets(c.rules, c.state))
+	log.Infof("Rules loaded successfully, files: %d, targets: %d", len(docs), len(c.targets))
+	return errors.Join(errs...)
+}
 
-	// 清空旧配置
-	c.targets = make(map[string][]ConfigTarget)
-	c.backends = make(map[string][]Backend)
+// refreshState 重新获取规则中所有负载均衡器的状态并重新计算 targets。
+// 每个负载均衡器的新快照获取完成后整体替换旧快照，单个负载均衡器刷新失败时沿用其上一次成功的快照。
+// 调用方需持有 refreshMu
+func (c *Config) refreshState() {
+	c.mu.RLock()
+	ids := loadBalancerIDs(c.rules)
+	c.mu.RUnlock()
+
+	c.state.refresh(ids)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTargets(buildTargets(c.rules, c.state))
+	log.Infof("CLB state refreshed, targets: %d", len(c.targets))
+}
+
+// RefreshState 立即刷新负载均衡器状态，返回目标发生变化的 namespace/deployment
+func (c *Config) RefreshState() []string {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
 
-	log.Infof("Loaded configs: %v", configs)
+	c.mu.RLock()
+	old := c.targets
+	c.mu.RUnlock()
 
-	// 处理每个负载均衡器配置
-	for _, config := range configs {
-		// 获取负载均衡器的监听器列表
-		listeners, err := c.getListeners(config.LoadBalancerID)
-		log.Infof("listeners: %v", listeners)
+	c.refreshState()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return changedTargetKeys(old, c.targets)
+}
+
+// RunRefresh 按 RULES_RELOAD_INTERVAL 重新加载规则，按 CLB_STATE_REFRESH_INTERVAL 刷新负载均衡器状态，
+// 两者使用各自的定时器，直到 ctx 取消。目标发生变化时以变化的 namespace/deployment 调用 onChange
+func (c *Config) RunRefresh(ctx context.Context, onChange func(changed []string)) {
+	run := func(interval time.Duration, refresh func() []string) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if changed := refresh(); len(changed) > 0 {
+					onChange(changed)
+				}
+			}
+		}
+	}
+
+	go run(c.rulesInterval, func() []string {
+		changed, err := c.Reload()
 		if err != nil {
-			log.Errorf("Failed to get listeners for LB %s: %v", config.LoadBalancerID, err)
-			continue
+			log.Errorf("Failed to reload rules: %v", err)
 		}
+		return changed
+	})
+	go run(c.stateInterval, c.RefreshState)
+}
+
+// UnresolvedRule 是无法与负载均衡器上的监听器或转发规则匹配的配置
+type UnresolvedRule struct {
+	LoadBalancerID string `json:"load_balancer_id"`
+	Protocol       string `json:"protocol"`
+	Port           int    `json:"port"`
+	Domain         string `json:"domain"`
+	URL            string `json:"url"`
+	Namespace      string `json:"namespace"`
+	Deployment     string `json:"deployment"`
+	File           string `json:"file"`
+	Reason         string `json:"reason"`
+}
+
+func (u UnresolvedRule) String() string {
+	return fmt.Sprintf("%s %s:%d %s%s -> %s/%s: %s",
+		u.LoadBalancerID, strings.ToUpper(u.Protocol), u.Port, u.Domain, u.URL, u.Namespace, u.Deployment, u.Reason)
+}
+
+// buildTargets 将规则与负载均衡器的监听器和转发规则匹配，得到每个 namespace/deployment 的目标，
+// 以及无法匹配的配置及原因
+func buildTargets(rules []RuleConfig, state *clbState) (map[string][]ConfigTarget, []UnresolvedRule) {
+	targets := make(map[string][]ConfigTarget)
+	var unresolved []UnresolvedRule
+
+	for _, config := range rules {
+		listeners, ok := state.listeners(config.LoadBalancerID)
 
 		// 匹配配置文件中的转发策略与监听器的转发策略
 		for _, configListener := range config.Listeners {
-			for _, listener := range listeners {
-				if configListener.Port == listener.Port &&
-					strings.ToLower(configListener.Protocol) == strings.ToLower(listener.Protocol) {
+			protocol := strings.ToUpper(configListener.Protocol)
 
-					for _, configRule := range configListener.Rules {
-						for _, rule := range listener.Rules {
-							if configRule.Domain == rule.Domain && configRule.URL == rule.URL {
-								ns := configRule.Backend.Namespace
-								deploy := configRule.Backend.Deployment
-								port := configRule.Backend.Port
+			var matched *Listener
+			for i, listener := range listeners {
+				if configListener.Port == listener.Port && protocol == strings.ToUpper(listener.Protocol) {
+					matched = &listeners[i]
+					break
+				}
+			}
 
-								// 创建目标配置
-								target := ConfigTarget{
+			for _, configRule := range configListener.Rules {
+				var split []SplitMember
+				for _, backend := range configRule.Backends {
+					split = append(split, SplitMember{
+						Namespace:  backend.Namespace,
+						Deployment: backend.Deployment,
+						Port:       backend.Port,
+						Share:      backend.Share,
+					})
+				}
+
+				for _, backend := range configRule.members() {
+					key := fmt.Sprintf("%s/%s", backend.Namespace, backend.Deployment)
+
+					var reason string
+					switch {
+					case !ok:
+						reason = "load balancer state not available"
+					case matched == nil:
+						reason = fmt.Sprintf("no %s listener on port %d", protocol, configListener.Port)
+					default:
+						found := false
+						for _, rule := range matched.Rules {
+							if configRule.Domain == rule.Domain && configRule.URL == rule.URL {
+								targets[key] = append(targets[key], ConfigTarget{
 									LoadBalancerID: config.LoadBalancerID,
-									ListenerID:     listener.ListenerID,
+									ListenerID:     matched.ListenerID,
 									LocationID:     rule.LocationID,
-									Port:           port,
-								}
-
-								// 添加到目标列表
-								key := fmt.Sprintf("%s/%s", ns, deploy)
-								c.targets[key] = append(c.targets[key], target)
-
-								// 创建后端配置
-								var backends []Backend
-								for _, target := range rule.Targets {
-									if len(target.PrivateIPAddresses) > 0 {
-										backends = append(backends, Backend{
-											IP:   target.PrivateIPAddresses[0],
-											Port: target.Port,
-										})
-									}
-								}
-
-								if len(backends) > 0 {
-									backendKey := fmt.Sprintf("%s/%s/%s/%s/%s",
-										ns, deploy, config.LoadBalancerID, listener.ListenerID, rule.LocationID)
-									c.backends[backendKey] = backends
-								}
+									Port:           backend.Port,
+									Weight:         backend.Weight,
+									SlowStart:      backend.SlowStart,
+									Safety:         backend.Safety,
+									Split:          split,
+								})
+								found = true
 							}
 						}
+						if !found {
+							reason = fmt.Sprintf("no rule for domain %s url %s", configRule.Domain, configRule.URL)
+						}
+					}
+
+					if reason != "" {
+						unresolved = append(unresolved, UnresolvedRule{
+							LoadBalancerID: config.LoadBalancerID,
+							Protocol:       configListener.Protocol,
+							Port:           configListener.Port,
+							Domain:         configRule.Domain,
+							URL:            configRule.URL,
+							Namespace:      backend.Namespace,
+							Deployment:     backend.Deployment,
+							File:           config.file,
+							Reason:         reason,
+						})
 					}
 				}
 			}
 		}
 	}
 
-	c.lastLoad = time.Now()
-	log.Infof("Config loaded successfully, targets: %d, backends: %d", len(c.targets), len(c.backends))
-	return nil
+	return targets, unresolved
+}
+
+// setTargets 更新 targets 和无法匹配的配置，无法匹配的配置发生变化时输出日志并更新指标。
+// 调用方需持有 mu
+func (c *Config) setTargets(targets map[string][]ConfigTarget, unresolved []UnresolvedRule) {
+	c.targets = targets
+
+	if !reflect.DeepEqual(unresolved, c.unresolved) {
+		for _, u := range unresolved {
+			log.Warnf("Unresolved rule: %s", u)
+		}
+		unresolvedRules.Reset()
+		for _, u := range unresolved {
+			unresolvedRules.WithLabelValues(u.LoadBalancerID).Inc()
+		}
+	}
+	c.unresolved = unresolved
+}
+
+// UnresolvedRules 返回最近一次计算 targets 时无法匹配的配置
+func (c *Config) UnresolvedRules() []UnresolvedRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]UnresolvedRule(nil), c.unresolved...)
 }
 
 func (c *Config) getListeners(loadBalancerID string) ([]Listener, error) {
@@ -182,51 +487,142 @@ func (c *Config) getListeners(loadBalancerID string) ([]Listener, error) {
 func (c *Config) GetTargets(key string) []ConfigTarget {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	return c.targets[key]
+}
 
-	// 尝试重新加载配置（如果过期）
-	if time.Since(c.lastLoad) >= 60*time.Second {
-		c.mu.RUnlock()
-		c.loadConfig()
-		c.mu.RLock()
+// Bindings 返回所有 namespace/deployment 的目标
+func (c *Config) Bindings() map[string][]ConfigTarget {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	bindings := make(map[string][]ConfigTarget, len(c.targets))
+	for key, targets := range c.targets {
+		bindings[key] = append([]ConfigTarget(nil), targets...)
 	}
+	return bindings
+}
 
-	return c.targets[key]
+// RulesStatus 是当前生效规则的来源和版本
+type RulesStatus struct {
+	Source   string            `json:"source"`
+	Version  string            `json:"version"`
+	LoadedAt time.Time         `json:"loaded_at"`
+	Files    []RulesFileStatus `json:"files"`
 }
 
-func (c *Config) GetBackendIPs(key string) []string {
+// RulesFileStatus 是单个规则文件的状态
+type RulesFileStatus struct {
+	Name     string `json:"name"`
+	Bindings int    `json:"bindings"`
+	// 文件无效时的错误，此时沿用该文件上一次成功解析的规则
+	Error string `json:"error,omitempty"`
+}
+
+func (c *Config) RulesStatus() RulesStatus {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	backends := c.backends[key]
-	var ips []string
-	for _, backend := range backends {
-		ips = append(ips, backend.IP)
+	return RulesStatus{
+		Source:   c.source.String(),
+		Version:  c.version,
+		LoadedAt: c.rulesLoadedAt,
+		Files:    append([]RulesFileStatus(nil), c.files...),
 	}
-	return ips
 }
 
-func (c *Config) GetBackendIPPorts(key string) []string {
+// Ready 在规则已加载，且至少获取到规则中一个负载均衡器的状态时返回 nil。
+// 单个负载均衡器的状态不可用时作为无法匹配的配置报告
+func (c *Config) Ready() error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	backends := c.backends[key]
-	var ipPorts []string
-	for _, backend := range backends {
-		ipPorts = append(ipPorts, fmt.Sprintf("%s:%d", backend.IP, backend.Port))
+	if c.rulesLoadedAt.IsZero() {
+		return fmt.Errorf("rules from %s not loaded", c.source)
 	}
-	return ipPorts
+	ids := loadBalancerIDs(c.rules)
+	if len(ids) > 0 && len(c.state.missing(ids)) == len(ids) {
+		return fmt.Errorf("state of none of the %d load balancers is available", len(ids))
+	}
+	return nil
 }
 
-func (c *Config) GetBackendChangePortIPs(key string, targetPort int) []string {
+// Conflicts 返回合并规则文件时因冲突而被忽略的配置
+func (c *Config) Conflicts() []RuleConflict {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	return append([]RuleConflict(nil), c.conflicts...)
+}
+
+// Reload 立即重新加载规则，返回目标发生变化的 namespace/deployment。
+// 部分规则文件无效时，其余文件的变化仍然生效并返回
+func (c *Config) Reload() ([]string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	old := c.targets
+	c.mu.RUnlock()
+
+	err := c.loadRules()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return changedTargetKeys(old, c.targets), err
+}
+
+// changedTargetKeys 返回新增或目标列表发生变化的 key
+func changedTargetKeys(old, new map[string][]ConfigTarget) []string {
+	var keys []string
+	for key, targets := range new {
+		if !reflect.DeepEqual(old[key], targets) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Config) GetBackendIPs(target ConfigTarget) []string {
+	var ips []string
+	for _, backend := range c.state.backends(target) {
+		ips = append(ips, backend.IP)
+	}
+	return ips
+}
 
-	backends := c.backends[key]
+func (c *Config) GetBackendIPPorts(target ConfigTarget) []string {
 	var ipPorts []string
-	for _, backend := range backends {
-		if backend.Port != targetPort {
+	for _, backend := range c.state.backends(target) {
+		ipPorts = append(ipPorts, fmt.Sprintf("%s:%d", backend.IP, backend.Port))
+	}
+	return ipPorts
+}
+
+func (c *Config) GetBackendChangePortIPs(target ConfigTarget) []string {
+	var ipPorts []string
+	for _, backend := range c.state.backends(target) {
+		if backend.Port != target.Port {
 			ipPorts = append(ipPorts, fmt.Sprintf("%s:%d", backend.IP, backend.Port))
 		}
 	}
 	return ipPorts
 }
+
+// RecordRegistered 在绑定任务完成后记录新增的后端，避免在下次刷新前重复绑定
+func (c *Config) RecordRegistered(target ConfigTarget, backends []Backend) {
+	c.state.record(target, backends, nil)
+}
+
+// RecordDeregistered 在解绑任务完成后移除已解绑的后端
+func (c *Config) RecordDeregistered(target ConfigTarget, backends []Backend) {
+	c.state.record(target, nil, backends)
+}
+
+// GetBackendWeights 返回转发规则上当前绑定的后端的权重
+func (c *Config) GetBackendWeights(target ConfigTarget) map[Backend]int {
+	return c.state.weights(target)
+}
+
+// RecordWeights 在绑定或修改权重的任务完成后记录后端的权重
+func (c *Config) RecordWeights(target ConfigTarget, weights map[Backend]int) {
+	c.state.recordWeights(target, weights)
+}
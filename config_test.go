@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTargetsReportsUnresolvedRules(t *testing.T) {
+	rules, err := parseRules([]byte(`- load_balancer_id: lb-00000001
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: example.com
+          url: /api
+          backend:
+            namespace: default
+            deployment: my-app
+            port: 8080
+        - domain: example.com
+          url: /missing
+          backend:
+            namespace: default
+            deployment: other
+            port: 8080
+    - port: 443
+      protocol: https
+      rules:
+        - domain: example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: secure
+            port: 8080
+- load_balancer_id: lb-00000002
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: unknown-lb
+            port: 8080
+`))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+
+	state := newCLBState(func(string) ([]Listener, error) { return testListeners(), nil })
+	state.refresh([]string{"lb-00000001"})
+
+	targets, unresolved := buildTargets(rules, state)
+
+	wantTargets := map[string][]ConfigTarget{"default/my-app": {testTarget}}
+	if !reflect.DeepEqual(targets, wantTargets) {
+		t.Errorf("buildTargets() targets = %v, want %v", targets, wantTargets)
+	}
+
+	var reasons []string
+	for _, u := range unresolved {
+		reasons = append(reasons, u.Namespace+"/"+u.Deployment+": "+u.Reason)
+	}
+	wantReasons := []string{
+		"default/other: no rule for domain example.com url /missing",
+		"default/secure: no HTTPS listener on port 443",
+		"default/unknown-lb: load balancer state not available",
+	}
+	if !reflect.DeepEqual(reasons, wantReasons) {
+		t.Errorf("buildTargets() unresolved = %v, want %v", reasons, wantReasons)
+	}
+}
+
+func TestBuildTargetsSplit(t *testing.T) {
+	rules, err := parseRules([]byte(`- load_balancer_id: lb-00000001
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: example.com
+          url: /api
+          backends:
+            - namespace: default
+              deployment: api-stable
+              port: 8080
+              share: 90
+            - namespace: default
+              deployment: api-canary
+              port: 8081
+              share: 10
+`))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+
+	state := newCLBState(func(string) ([]Listener, error) { return testListeners(), nil })
+	state.refresh([]string{"lb-00000001"})
+
+	targets, unresolved := buildTargets(rules, state)
+	if len(unresolved) != 0 {
+		t.Fatalf("buildTargets() unresolved = %v, want none", unresolved)
+	}
+
+	split := []SplitMember{
+		{Namespace: "default", Deployment: "api-stable", Port: 8080, Share: 90},
+		{Namespace: "default", Deployment: "api-canary", Port: 8081, Share: 10},
+	}
+	stable := testTarget
+	stable.Split = split
+	canary := testTarget
+	canary.Port = 8081
+	canary.Split = split
+	want := map[string][]ConfigTarget{
+		"default/api-stable": {stable},
+		"default/api-canary": {canary},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("buildTargets() targets = %+v, want %+v", targets, want)
+	}
+}
+
+func TestConfigKeepsOtherFilesWhenOneIsBroken(t *testing.T) {
+	dir := t.TempDir()
+	teamA := filepath.Join(dir, "team-a.yaml")
+	teamB := filepath.Join(dir, "team-b.yaml")
+	os.WriteFile(teamA, []byte(rulesFor("lb-00000001", "", "example.com", "app-a")), 0o644)
+	os.WriteFile(teamB, []byte(strings.Replace(rulesFor("lb-00000001", "", "example.com", "app-b"), "url: /", "url: /b", 1)), 0o644)
+
+	cfg := &Config{
+		source:        newDirRulesSource(dir),
+		rulesInterval: time.Hour,
+		stateInterval: time.Hour,
+		tencent:       newTestClientPool(),
+	}
+	cfg.state = newCLBState(func(string) ([]Listener, error) {
+		listeners := testListeners()
+		listeners[0].Rules = []Rule{
+			{Domain: "example.com", URL: "/", LocationID: "loc-a"},
+			{Domain: "example.com", URL: "/b", LocationID: "loc-b"},
+		}
+		return listeners, nil
+	})
+
+	if _, err := cfg.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	// team-b 的文件损坏时沿用其上一次的规则，team-a 的修改照常生效
+	os.WriteFile(teamB, []byte("- load_balancer_id: [\n"), 0o644)
+	os.WriteFile(teamA, []byte(rulesFor("lb-00000001", "", "example.com", "app-a2")), 0o644)
+
+	changed, err := cfg.Reload()
+	if err == nil {
+		t.Fatal("Reload() error = nil, want error for broken file")
+	}
+	if !reflect.DeepEqual(changed, []string{"default/app-a2"}) {
+		t.Errorf("Reload() changed = %v, want [default/app-a2]", changed)
+	}
+	if got := cfg.GetTargets("default/app-b"); len(got) != 1 || got[0].LocationID != "loc-b" {
+		t.Errorf("GetTargets(default/app-b) = %v, want binding kept from previous rules", got)
+	}
+
+	status := cfg.RulesStatus()
+	if len(status.Files) != 2 || status.Files[0].Error != "" || status.Files[1].Error == "" {
+		t.Errorf("RulesStatus().Files = %+v, want team-b marked invalid", status.Files)
+	}
+}
+
+func TestConfigReady(t *testing.T) {
+	rules := []RuleConfig{{LoadBalancerID: "lb-1"}, {LoadBalancerID: "lb-2"}}
+	available := map[string]bool{}
+	cfg := &Config{source: newFileRulesSource("rules.yaml"), rules: rules}
+	cfg.state = newCLBState(func(id string) ([]Listener, error) {
+		if !available[id] {
+			return nil, errors.New("InternalError")
+		}
+		return nil, nil
+	})
+
+	if err := cfg.Ready(); err == nil {
+		t.Error("Ready() should fail before rules are loaded")
+	}
+
+	cfg.rulesLoadedAt = time.Now()
+	cfg.state.refresh([]string{"lb-1", "lb-2"})
+	if err := cfg.Ready(); err == nil {
+		t.Error("Ready() should fail when no load balancer state is available")
+	}
+
+	// 单个负载均衡器的状态不可用和无法匹配的配置不影响就绪
+	available["lb-2"] = true
+	cfg.state.refresh([]string{"lb-1", "lb-2"})
+	cfg.unresolved = []UnresolvedRule{{LoadBalancerID: "lb-1", Reason: "load balancer state not available"}}
+	if err := cfg.Ready(); err != nil {
+		t.Errorf("Ready() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+)
+
+const (
+	// 默认的凭证来源顺序，第一个可用的来源生效
+	defaultCredentialProviders = "oidc,sts,env,file,cvm"
+	// 临时凭证在过期前多久刷新
+	credentialRefreshWindow = 5 * time.Minute
+	// 刷新失败后的重试间隔
+	credentialRetryInterval = 30 * time.Second
+
+	defaultRoleSessionName = "sync-pod-to-clb"
+	defaultRoleDuration    = 2 * time.Hour
+
+	stsVersion = "2018-08-13"
+	cvmRoleURL = "http://metadata.tencentyun.com/latest/meta-data/cam/security-credentials/"
+)
+
+// credentialValue 是某一时刻的凭证快照，expiresAt 为零表示长期凭证
+type credentialValue struct {
+	secretID  string
+	secretKey string
+	token     string
+	expiresAt time.Time
+}
+
+// credentialSource 是一种凭证来源
+type credentialSource interface {
+	name() string
+	retrieve() (credentialValue, error)
+}
+
+// credential 返回与快照对应的静态凭证
+func (v *credentialValue) credential() *common.Credential {
+	return common.NewTokenCredential(v.secretID, v.secretKey, v.token)
+}
+
+// refreshingCredential 实现 common.CredentialIface，在后台于临时凭证过期前或
+// 凭证文件变化后从来源重新获取，并整体替换当前的凭证快照。
+// 获取凭证的调用方不会等待刷新，刷新失败时继续使用旧凭证并按 credentialRetryInterval 重试
+type refreshingCredential struct {
+	source      credentialSource
+	value       atomic.Pointer[credentialValue]
+	invalidated chan struct{}
+}
+
+func newRefreshingCredential(source credentialSource) (*refreshingCredential, error) {
+	value, err := source.retrieve()
+	if err != nil {
+		return nil, err
+	}
+	c := &refreshingCredential{source: source, invalidated: make(chan struct{}, 1)}
+	c.value.Store(&value)
+	return c, nil
+}
+
+// snapshot 返回当前的凭证快照，同一请求的 SecretId、SecretKey 和 Token 应取自同一快照
+func (c *refreshingCredential) snapshot() *credentialValue {
+	return c.value.Load()
+}
+
+// start 启动后台刷新，ctx 结束时停止
+func (c *refreshingCredential) start(ctx context.Context) {
+	go c.run(ctx)
+}
+
+func (c *refreshingCredential) run(ctx context.Context) {
+	failed := false
+	for {
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait, ok := c.nextRefresh(failed); ok {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-timeout:
+		case <-c.invalidated:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+		failed = !c.refresh()
+	}
+}
+
+// nextRefresh 返回距下次刷新的时间，长期凭证只在失效后刷新。
+// 两次刷新至少间隔 credentialRetryInterval，来源返回的凭证有效期短于刷新窗口时也不会连续请求
+func (c *refreshingCredential) nextRefresh(failed bool) (time.Duration, bool) {
+	if failed {
+		return credentialRetryInterval, true
+	}
+	expiresAt := c.snapshot().expiresAt
+	if expiresAt.IsZero() {
+		return 0, false
+	}
+	wait := time.Until(expiresAt.Add(-credentialRefreshWindow))
+	if wait < credentialRetryInterval {
+		wait = credentialRetryInterval
+	}
+	return wait, true
+}
+
+// refresh 从来源重新获取凭证，成功时替换当前快照
+func (c *refreshingCredential) refresh() bool {
+	value, err := c.source.retrieve()
+	if err != nil {
+		// 刷新失败时继续使用旧凭证，稍后重试
+		log.Errorf("Failed to refresh %s credential, retrying in %s: %v", c.source.name(), credentialRetryInterval, err)
+		return false
+	}
+	c.value.Store(&value)
+	log.Infof("Refreshed %s credential", c.source.name())
+	return true
+}
+
+// invalidate 通知后台立即重新获取凭证
+func (c *refreshingCredential) invalidate() {
+	select {
+	case c.invalidated <- struct{}{}:
+	default:
+	}
+}
+
+func (c *refreshingCredential) GetSecretId() string  { return c.snapshot().secretID }
+func (c *refreshingCredential) GetSecretKey() string { return c.snapshot().secretKey }
+func (c *refreshingCredential) GetToken() string     { return c.snapshot().token }
+
+// envCredentialSource 从环境变量读取长期密钥
+type envCredentialSource struct{}
+
+func (envCredentialSource) name() string { return "env" }
+
+func (envCredentialSource) retrieve() (credentialValue, error) {
+	secretID := os.Getenv("CLOUD_TENCENT_SECRET_ID")
+	secretKey := os.Getenv("CLOUD_TENCENT_SECRET_KEY")
+	if secretID == "" || secretKey == "" {
+		return credentialValue{}, fmt.Errorf("CLOUD_TENCENT_SECRET_ID and CLOUD_TENCENT_SECRET_KEY must be set")
+	}
+	return credentialValue{secretID: secretID, secretKey: secretKey}, nil
+}
+
+// fileCredentialSource 从挂载的 Secret 目录读取 secret-id、secret-key 和可选的 token 文件
+type fileCredentialSource struct {
+	dir string
+}
+
+func (s fileCredentialSource) name() string { return "file" }
+
+func (s fileCredentialSource) retrieve() (credentialValue, error) {
+	read := func(name string, required bool) (string, error) {
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			if !required && os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	var value credentialValue
+	var err error
+	if value.secretID, err = read("secret-id", true); err != nil {
+		return value, err
+	}
+	if value.secretKey, err = read("secret-key", true); err != nil {
+		return value, err
+	}
+	if value.token, err = read("token", false); err != nil {
+		return value, err
+	}
+	if value.secretID == "" || value.secretKey == "" {
+		return value, fmt.Errorf("secret-id and secret-key in %s must not be empty", s.dir)
+	}
+	return value, nil
+}
+
+// cvmRoleCredentialSource 从 CVM 元数据服务获取实例角色的临时凭证
+type cvmRoleCredentialSource struct {
+	url      string
+	roleName string
+	client   *http.Client
+}
+
+func (s *cvmRoleCredentialSource) name() string { return "cvm" }
+
+func (s *cvmRoleCredentialSource) get(url string) ([]byte, error) {
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata server returned %s for %s", resp.Status, url)
+	}
+	return body, nil
+}
+
+func (s *cvmRoleCredentialSource) retrieve() (credentialValue, error) {
+	roleName := s.roleName
+	if roleName == "" {
+		body, err := s.get(s.url)
+		if err != nil {
+			return credentialValue{}, fmt.Errorf("failed to get CVM role name: %v", err)
+		}
+		roleName = strings.TrimSpace(string(body))
+	}
+
+	body, err := s.get(s.url + roleName)
+	if err != nil {
+		return credentialValue{}, fmt.Errorf("failed to get CVM role credential: %v", err)
+	}
+
+	var resp struct {
+		TmpSecretId  string `json:"TmpSecretId"`
+		TmpSecretKey string `json:"TmpSecretKey"`
+		Token        string `json:"Token"`
+		ExpiredTime  int64  `json:"ExpiredTime"`
+		Code         string `json:"Code"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return credentialValue{}, fmt.Errorf("failed to parse CVM role credential: %v", err)
+	}
+	if resp.Code != "Success" {
+		return credentialValue{}, fmt.Errorf("metadata server returned code %s for role %s", resp.Code, roleName)
+	}
+	return credentialValue{
+		secretID:  resp.TmpSecretId,
+		secretKey: resp.TmpSecretKey,
+		token:     resp.Token,
+		expiresAt: time.Unix(resp.ExpiredTime, 0),
+	}, nil
+}
+
+// stsCredentialSource 通过 STS AssumeRole（使用长期密钥）或
+// AssumeRoleWithWebIdentity（使用 TKE OIDC 令牌）获取角色的临时凭证
+type stsCredentialSource struct {
+	region          string
+	roleArn         string
+	roleSessionName string
+	duration        time.Duration
+	endpoint        endpointSettings
+
+	// AssumeRole 使用的长期密钥来源
+	base credentialSource
+
+	// AssumeRoleWithWebIdentity 使用的 OIDC 提供商和令牌文件，每次刷新都重新读取令牌
+	providerID string
+	tokenFile  string
+}
+
+func (s *stsCredentialSource) name() string {
+	if s.tokenFile != "" {
+		return "oidc"
+	}
+	return "sts"
+}
+
+func (s *stsCredentialSource) retrieve() (credentialValue, error) {
+	cpf := profile.NewClientProfile()
+	if s.endpoint.endpoint != "" {
+		cpf.HttpProfile.Scheme = s.endpoint.scheme
+		cpf.HttpProfile.Endpoint = s.endpoint.endpoint
+	}
+	if s.endpoint.requestTimeout > 0 {
+		cpf.HttpProfile.ReqTimeout = int(s.endpoint.requestTimeout / time.Second)
+	}
+	cpf.HttpProfile.ReqMethod = "POST"
+
+	params := map[string]interface{}{
+		"RoleArn":         s.roleArn,
+		"RoleSessionName": s.roleSessionName,
+		"DurationSeconds": int64(s.duration.Seconds()),
+	}
+
+	var client *common.Client
+	var request *tchttp.CommonRequest
+	if s.tokenFile != "" {
+		token, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return credentialValue{}, fmt.Errorf("failed to read web identity token: %v", err)
+		}
+		params["ProviderId"] = s.providerID
+		params["WebIdentityToken"] = strings.TrimSpace(string(token))
+
+		client = common.NewCommonClient(nil, s.region, cpf)
+		request = tchttp.NewCommonRequest("sts", stsVersion, "AssumeRoleWithWebIdentity")
+		request.SetSkipSign(true)
+	} else {
+		base, err := s.base.retrieve()
+		if err != nil {
+			return credentialValue{}, fmt.Errorf("failed to get %s credential for AssumeRole: %v", s.base.name(), err)
+		}
+		credential := common.NewTokenCredential(base.secretID, base.secretKey, base.token)
+		client = common.NewCommonClient(credential, s.region, cpf)
+		request = tchttp.NewCommonRequest("sts", stsVersion, "AssumeRole")
+	}
+
+	if s.endpoint.transport != nil {
+		client.WithHttpTransport(s.endpoint.transport)
+	}
+
+	if err := request.SetActionParameters(params); err != nil {
+		return credentialValue{}, err
+	}
+	response := tchttp.NewCommonResponse()
+	if err := client.Send(request, response); err != nil {
+		return credentialValue{}, err
+	}
+
+	var resp struct {
+		Response struct {
+			Credentials struct {
+				Token        string `json:"Token"`
+				TmpSecretId  string `json:"TmpSecretId"`
+				TmpSecretKey string `json:"TmpSecretKey"`
+			} `json:"Credentials"`
+			ExpiredTime int64 `json:"ExpiredTime"`
+		} `json:"Response"`
+	}
+	if err := json.Unmarshal(response.GetBody(), &resp); err != nil {
+		return credentialValue{}, fmt.Errorf("failed to parse STS response: %v", err)
+	}
+	return credentialValue{
+		secretID:  resp.Response.Credentials.TmpSecretId,
+		secretKey: resp.Response.Credentials.TmpSecretKey,
+		token:     resp.Response.Credentials.Token,
+		expiresAt: time.Unix(resp.Response.ExpiredTime, 0),
+	}, nil
+}
+
+// credentialSourceFromEnv 根据环境变量构造指定名称的凭证来源，未配置时返回 nil
+func credentialSourceFromEnv(name, region string, stsEndpoint endpointSettings) (credentialSource, error) {
+	switch name {
+	case "env":
+		if os.Getenv("CLOUD_TENCENT_SECRET_ID") == "" && os.Getenv("CLOUD_TENCENT_SECRET_KEY") == "" {
+			return nil, nil
+		}
+		return envCredentialSource{}, nil
+	case "file":
+		dir := os.Getenv("CLOUD_TENCENT_CREDENTIALS_DIR")
+		if dir == "" {
+			return nil, nil
+		}
+		return fileCredentialSource{dir: dir}, nil
+	case "cvm":
+		return &cvmRoleCredentialSource{
+			url:      cvmRoleURL,
+			roleName: os.Getenv("CLOUD_TENCENT_CVM_ROLE"),
+			client:   &http.Client{Timeout: 2 * time.Second},
+		}, nil
+	case "sts", "oidc":
+		duration, err := roleDurationFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		sessionName := os.Getenv("CLOUD_TENCENT_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = defaultRoleSessionName
+		}
+		source := &stsCredentialSource{region: region, roleSessionName: sessionName, duration: duration, endpoint: stsEndpoint}
+
+		if name == "oidc" {
+			// 与 TKE 注入的环境变量保持一致
+			source.roleArn = os.Getenv("TKE_ROLE_ARN")
+			source.providerID = os.Getenv("TKE_PROVIDER_ID")
+			source.tokenFile = os.Getenv("TKE_IDENTITY_TOKEN_FILE")
+			if source.roleArn == "" || source.providerID == "" || source.tokenFile == "" {
+				return nil, nil
+			}
+			if tkeRegion := os.Getenv("TKE_REGION"); tkeRegion != "" {
+				source.region = tkeRegion
+			}
+			return source, nil
+		}
+
+		source.roleArn = os.Getenv("CLOUD_TENCENT_ROLE_ARN")
+		if source.roleArn == "" {
+			return nil, nil
+		}
+		// AssumeRole 使用环境变量或挂载文件中的长期密钥
+		for _, baseName := range []string{"env", "file"} {
+			base, err := credentialSourceFromEnv(baseName, region, stsEndpoint)
+			if err != nil {
+				return nil, err
+			}
+			if base != nil {
+				source.base = base
+				return source, nil
+			}
+		}
+		return nil, fmt.Errorf("CLOUD_TENCENT_ROLE_ARN requires credentials from env or CLOUD_TENCENT_CREDENTIALS_DIR")
+	default:
+		return nil, fmt.Errorf("unknown credential provider %q", name)
+	}
+}
+
+// roleDurationFromEnv 读取扮演角色得到的临时凭证的有效期。有效期需长于刷新窗口，
+// 否则凭证一取得就进入刷新窗口
+func roleDurationFromEnv() (time.Duration, error) {
+	duration, err := envDuration("CLOUD_TENCENT_ROLE_DURATION", defaultRoleDuration)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= credentialRefreshWindow || duration > 12*time.Hour {
+		return 0, fmt.Errorf("CLOUD_TENCENT_ROLE_DURATION must be longer than %s and at most 12h", credentialRefreshWindow)
+	}
+	return duration, nil
+}
+
+// newCredentialFromEnv 按 CLOUD_TENCENT_CREDENTIAL_PROVIDERS 的顺序依次尝试各凭证来源，
+// 返回第一个可用的凭证，凭证在 ctx 结束前于后台刷新
+func newCredentialFromEnv(ctx context.Context, region string, stsEndpoint endpointSettings) (*refreshingCredential, error) {
+	providers := os.Getenv("CLOUD_TENCENT_CREDENTIAL_PROVIDERS")
+	if providers == "" {
+		providers = defaultCredentialProviders
+	}
+
+	var errs []string
+	for _, name := range strings.Split(providers, ",") {
+		name = strings.TrimSpace(name)
+		source, err := credentialSourceFromEnv(name, region, stsEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		if source == nil {
+			continue
+		}
+
+		credential, err := newRefreshingCredential(source)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+
+		log.Infof("Using %s credential provider", source.name())
+		if fileSource, ok := source.(fileCredentialSource); ok {
+			if err := watchCredentialDir(ctx, fileSource.dir, credential); err != nil {
+				return nil, err
+			}
+		}
+		credential.start(ctx)
+		return credential, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no credential provider configured in %q", providers)
+	}
+	return nil, fmt.Errorf("no usable credential provider: %s", strings.Join(errs, "; "))
+}
+
+// watchCredentialDir 监听挂载的 Secret 目录，文件变化（包括 Kubernetes 的符号链接切换）
+// 后使凭证失效，由后台立即重新读取
+func watchCredentialDir(ctx context.Context, dir string, credential *refreshingCredential) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create credential watcher: %v", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %v", dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				log.Debugf("Credential directory event: %v", event)
+				credential.invalidate()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("Credential watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// newProfileCredential 加载 CLOUD_TENCENT_PROFILES_DIR 下以凭证配置名命名的目录，
+// 目录结构与 CLOUD_TENCENT_CREDENTIALS_DIR 相同；若目录中存在 role-arn 文件，
+// 则使用其中的密钥扮演该角色（用于跨账号访问）
+func newProfileCredential(ctx context.Context, profile, region string, stsEndpoint endpointSettings) (*refreshingCredential, error) {
+	profilesDir := os.Getenv("CLOUD_TENCENT_PROFILES_DIR")
+	if profilesDir == "" {
+		return nil, fmt.Errorf("CLOUD_TENCENT_PROFILES_DIR must be set to use credential profiles")
+	}
+	if profile != filepath.Base(profile) || profile == "." || profile == ".." {
+		return nil, fmt.Errorf("invalid credential profile name %q", profile)
+	}
+
+	dir := filepath.Join(profilesDir, profile)
+	var source credentialSource = fileCredentialSource{dir: dir}
+
+	roleArn, err := os.ReadFile(filepath.Join(dir, "role-arn"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read role-arn: %v", err)
+	}
+	if err == nil {
+		duration, err := roleDurationFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		sessionName := os.Getenv("CLOUD_TENCENT_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = defaultRoleSessionName
+		}
+		source = &stsCredentialSource{
+			region:          region,
+			roleArn:         strings.TrimSpace(string(roleArn)),
+			roleSessionName: sessionName,
+			duration:        duration,
+			endpoint:        stsEndpoint,
+			base:            source,
+		}
+	}
+
+	credential, err := newRefreshingCredential(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := watchCredentialDir(ctx, dir, credential); err != nil {
+		return nil, err
+	}
+	credential.start(ctx)
+	return credential, nil
+}
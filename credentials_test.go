@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeCredentialSource struct {
+	values []credentialValue
+	calls  int
+}
+
+func (s *fakeCredentialSource) name() string { return "fake" }
+
+func (s *fakeCredentialSource) retrieve() (credentialValue, error) {
+	s.calls++
+	if s.calls > len(s.values) {
+		return credentialValue{}, fmt.Errorf("no more credentials")
+	}
+	return s.values[s.calls-1], nil
+}
+
+func TestRefreshingCredential(t *testing.T) {
+	source := &fakeCredentialSource{values: []credentialValue{
+		{secretID: "id-1", secretKey: "key-1", token: "token-1", expiresAt: time.Now().Add(time.Minute)},
+		{secretID: "id-2", secretKey: "key-2", token: "token-2", expiresAt: time.Now().Add(time.Hour)},
+	}}
+
+	credential, err := newRefreshingCredential(source)
+	if err != nil {
+		t.Fatalf("newRefreshingCredential() error = %v", err)
+	}
+
+	// 读取凭证不触发刷新
+	if got := credential.GetSecretId(); got != "id-1" || source.calls != 1 {
+		t.Errorf("GetSecretId() = %q after %d retrievals, want id-1 after 1", got, source.calls)
+	}
+
+	// 第一份凭证已进入刷新窗口，应尽快刷新，但至少间隔重试间隔以免连续请求来源
+	if wait, ok := credential.nextRefresh(false); !ok || wait != credentialRetryInterval {
+		t.Errorf("nextRefresh() = %s, %t, want %s", wait, ok, credentialRetryInterval)
+	}
+	before := credential.snapshot()
+	if !credential.refresh() {
+		t.Fatal("refresh() should succeed")
+	}
+	if got := credential.GetToken(); got != "token-2" {
+		t.Errorf("GetToken() = %q, want token-2", got)
+	}
+	if before.secretID != "id-1" || before.token != "token-1" {
+		t.Errorf("earlier snapshot changed to %+v", before)
+	}
+	if wait, ok := credential.nextRefresh(false); !ok || wait < 50*time.Minute {
+		t.Errorf("nextRefresh() = %s, %t, want about 55m", wait, ok)
+	}
+
+	// 刷新失败时继续使用旧凭证，并在重试间隔后重试
+	if credential.refresh() {
+		t.Fatal("refresh() should fail")
+	}
+	if got := credential.GetSecretKey(); got != "key-2" {
+		t.Errorf("GetSecretKey() = %q, want key-2 to be kept after failed refresh", got)
+	}
+	if wait, _ := credential.nextRefresh(true); wait != credentialRetryInterval {
+		t.Errorf("nextRefresh() after failure = %s, want %s", wait, credentialRetryInterval)
+	}
+}
+
+// countingCredentialSource 返回长期凭证并记录获取次数，可在后台刷新时并发读取
+type countingCredentialSource struct {
+	calls atomic.Int32
+}
+
+func (s *countingCredentialSource) name() string { return "counting" }
+
+func (s *countingCredentialSource) retrieve() (credentialValue, error) {
+	s.calls.Add(1)
+	return credentialValue{secretID: "id", secretKey: "key"}, nil
+}
+
+func TestRefreshingCredentialStopsWithContext(t *testing.T) {
+	source := &countingCredentialSource{}
+	credential, err := newRefreshingCredential(source)
+	if err != nil {
+		t.Fatalf("newRefreshingCredential() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	credential.start(ctx)
+
+	credential.invalidate()
+	deadline := time.Now().Add(5 * time.Second)
+	for source.calls.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("credential was not refreshed after invalidate()")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// ctx 结束后后台刷新停止，失效通知不再触发刷新
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	credential.invalidate()
+	time.Sleep(50 * time.Millisecond)
+	if got := source.calls.Load(); got != 2 {
+		t.Errorf("retrievals = %d after cancel, want 2", got)
+	}
+}
+
+func TestRoleDurationFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: defaultRoleDuration},
+		{value: "1h", want: time.Hour},
+		{value: "12h", want: 12 * time.Hour},
+		{value: "5m", wantErr: true},
+		{value: "1s", wantErr: true},
+		{value: "13h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("CLOUD_TENCENT_ROLE_DURATION", tt.value)
+		got, err := roleDurationFromEnv()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("roleDurationFromEnv(%q) = %s, %v, want %s, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTencentClientUsesCredentialSnapshot(t *testing.T) {
+	source := &fakeCredentialSource{values: []credentialValue{
+		{secretID: "id-1", secretKey: "key-1", token: "token-1"},
+		{secretID: "id-2", secretKey: "key-2", token: "token-2"},
+	}}
+	credential, err := newRefreshingCredential(source)
+	if err != nil {
+		t.Fatalf("newRefreshingCredential() error = %v", err)
+	}
+	settings := tencentSettings{batchSize: maxBatchTargets, retry: testRetryPolicy, maxParallelLBs: 1}
+	tc, err := newTencentClient("ap-beijing", credential, settings, newClientLimits(settings))
+	if err != nil {
+		t.Fatalf("newTencentClient() error = %v", err)
+	}
+
+	first := tc.sdkClient()
+	if tc.sdkClient() != first {
+		t.Error("sdkClient() should be reused while the credential is unchanged")
+	}
+	if got := first.GetCredential(); got.GetSecretId() != "id-1" || got.GetToken() != "token-1" {
+		t.Errorf("client credential = %s/%s, want id-1/token-1", got.GetSecretId(), got.GetToken())
+	}
+
+	credential.refresh()
+	second := tc.sdkClient()
+	if second == first {
+		t.Fatal("sdkClient() should be rebuilt after the credential is refreshed")
+	}
+	if got := second.GetCredential(); got.GetSecretId() != "id-2" || got.GetSecretKey() != "key-2" || got.GetToken() != "token-2" {
+		t.Errorf("client credential = %s/%s/%s, want id-2/key-2/token-2", got.GetSecretId(), got.GetSecretKey(), got.GetToken())
+	}
+	// 已取得的客户端继续使用旧快照签名
+	if got := first.GetCredential().GetSecretId(); got != "id-1" {
+		t.Errorf("earlier client credential = %s, want id-1", got)
+	}
+}
+
+func TestFileCredentialSource(t *testing.T) {
+	dir := t.TempDir()
+	source := fileCredentialSource{dir: dir}
+
+	if _, err := source.retrieve(); err == nil {
+		t.Error("retrieve() should fail when secret files are missing")
+	}
+
+	os.WriteFile(filepath.Join(dir, "secret-id"), []byte("my-id\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "secret-key"), []byte("my-key\n"), 0600)
+
+	value, err := source.retrieve()
+	if err != nil {
+		t.Fatalf("retrieve() error = %v", err)
+	}
+	if value.secretID != "my-id" || value.secretKey != "my-key" || value.token != "" || !value.expiresAt.IsZero() {
+		t.Errorf("retrieve() = %+v", value)
+	}
+}
+
+func TestCvmRoleCredentialSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, "my-role")
+		case "/my-role":
+			fmt.Fprint(w, `{"TmpSecretId":"tmp-id","TmpSecretKey":"tmp-key","Token":"tmp-token","ExpiredTime":1900000000,"Code":"Success"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := &cvmRoleCredentialSource{url: server.URL + "/", client: server.Client()}
+	value, err := source.retrieve()
+	if err != nil {
+		t.Fatalf("retrieve() error = %v", err)
+	}
+	if value.secretID != "tmp-id" || value.token != "tmp-token" || value.expiresAt.Unix() != 1900000000 {
+		t.Errorf("retrieve() = %+v", value)
+	}
+}
+
+func TestCredentialSourceFromEnv(t *testing.T) {
+	t.Setenv("CLOUD_TENCENT_SECRET_ID", "")
+	t.Setenv("CLOUD_TENCENT_SECRET_KEY", "")
+	t.Setenv("CLOUD_TENCENT_CREDENTIALS_DIR", "")
+	t.Setenv("CLOUD_TENCENT_ROLE_ARN", "")
+	t.Setenv("TKE_ROLE_ARN", "")
+
+	for _, name := range []string{"env", "file", "sts", "oidc"} {
+		if source, err := credentialSourceFromEnv(name, "ap-beijing", endpointSettings{}); source != nil || err != nil {
+			t.Errorf("%s should be skipped when not configured, got %v, %v", name, source, err)
+		}
+	}
+
+	t.Setenv("CLOUD_TENCENT_ROLE_ARN", "qcs::cam::uin/100:roleName/clb")
+	if _, err := credentialSourceFromEnv("sts", "ap-beijing", endpointSettings{}); err == nil {
+		t.Error("sts without base credentials should fail")
+	}
+
+	t.Setenv("CLOUD_TENCENT_SECRET_ID", "id")
+	t.Setenv("CLOUD_TENCENT_SECRET_KEY", "key")
+	source, err := credentialSourceFromEnv("sts", "ap-beijing", endpointSettings{})
+	if err != nil {
+		t.Fatalf("credentialSourceFromEnv(sts) error = %v", err)
+	}
+	sts, ok := source.(*stsCredentialSource)
+	if !ok || sts.base.name() != "env" || sts.duration != defaultRoleDuration {
+		t.Errorf("unexpected sts source: %+v", source)
+	}
+
+	if _, err := credentialSourceFromEnv("unknown", "ap-beijing", endpointSettings{}); err == nil {
+		t.Error("unknown provider should fail")
+	}
+}
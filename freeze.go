@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// namespace 或 Deployment 上冻结变更的注解，值为 "true" 时生效
+	freezeAnnotation = "clb.tencent/freeze"
+	// 冻结开关 ConfigMap 中的 key，值为 "true" 时冻结
+	freezeConfigMapKey = "frozen"
+)
+
+// 全局冻结开关的来源
+const (
+	freezeSourceConfigMap = "configmap"
+	freezeSourceAdmin     = "admin"
+)
+
+// 重新同步有被跳过的变更的 Deployment 的间隔，以刷新漂移情况并在注解删除后执行变更
+const freezeResyncInterval = 30 * time.Second
+
+// FrozenChange 是冻结期间某个转发规则上被跳过的变更
+type FrozenChange struct {
+	Deployment     string   `json:"deployment"`
+	LoadBalancerID string   `json:"load_balancer_id"`
+	ListenerID     string   `json:"listener_id"`
+	LocationID     string   `json:"location_id"`
+	Port           int      `json:"port"`
+	Register       []string `json:"register,omitempty"`
+	Deregister     []string `json:"deregister,omitempty"`
+	ModifyWeight   []string `json:"modify_weight,omitempty"`
+}
+
+func (c FrozenChange) empty() bool {
+	return len(c.Register) == 0 && len(c.Deregister) == 0 && len(c.ModifyWeight) == 0
+}
+
+func (c FrozenChange) String() string {
+	var parts []string
+	if len(c.Register) > 0 {
+		parts = append(parts, fmt.Sprintf("register %v", c.Register))
+	}
+	if len(c.Deregister) > 0 {
+		parts = append(parts, fmt.Sprintf("deregister %v", c.Deregister))
+	}
+	if len(c.ModifyWeight) > 0 {
+		parts = append(parts, fmt.Sprintf("modify weight %v", c.ModifyWeight))
+	}
+	return fmt.Sprintf("%s %s/%s:%d -> %s: %s", c.LoadBalancerID, c.ListenerID, c.LocationID, c.Port, c.Deployment, strings.Join(parts, ", "))
+}
+
+// FreezeStatus 是 /status 展示的冻结状态
+type FreezeStatus struct {
+	Frozen bool `json:"frozen"`
+	// 开启了全局冻结的来源
+	Sources []string `json:"sources,omitempty"`
+	// 冻结期间被跳过、尚未执行的变更，包括通过注解冻结的 Deployment
+	SkippedChanges []FrozenChange `json:"skipped_changes,omitempty"`
+}
+
+// freezeSwitch 是全局冻结开关，任一来源开启时冻结所有负载均衡器变更，
+// 并记录冻结期间被跳过的变更
+type freezeSwitch struct {
+	mu      sync.Mutex
+	sources map[string]bool
+	skipped map[string]FrozenChange
+}
+
+func newFreezeSwitch() *freezeSwitch {
+	return &freezeSwitch{
+		sources: make(map[string]bool),
+		skipped: make(map[string]FrozenChange),
+	}
+}
+
+// frozen 返回是否开启了全局冻结
+func (f *freezeSwitch) frozen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sources) > 0
+}
+
+// set 开启或关闭某个来源的冻结，返回全局冻结状态是否由开启变为关闭
+func (f *freezeSwitch) set(source string, frozen bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sources[source] == frozen {
+		return false
+	}
+	wasFrozen := len(f.sources) > 0
+	if frozen {
+		f.sources[source] = true
+	} else {
+		delete(f.sources, source)
+	}
+	log.Warnf("Freeze from %s set to %t, frozen sources: %v", source, frozen, f.sourcesLocked())
+	if len(f.sources) > 0 {
+		globalFreeze.Set(1)
+		return false
+	}
+	globalFreeze.Set(0)
+	return wasFrozen
+}
+
+func (f *freezeSwitch) sourcesLocked() []string {
+	var sources []string
+	for source := range f.sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// skip 记录转发规则上某类被跳过的变更，backends 为空时清除该类变更
+func (f *freezeSwitch) skip(target ConfigTarget, deployment string, kind mutationKind, backends []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := queuedKey(target)
+	change, ok := f.skipped[key]
+	if !ok {
+		if len(backends) == 0 {
+			return
+		}
+		change = FrozenChange{
+			LoadBalancerID: target.LoadBalancerID,
+			ListenerID:     target.ListenerID,
+			LocationID:     target.LocationID,
+			Port:           target.Port,
+		}
+	}
+	change.Deployment = deployment
+	switch kind {
+	case mutationRegister:
+		change.Register = backends
+	case mutationDeregister:
+		change.Deregister = backends
+	case mutationModifyWeight:
+		change.ModifyWeight = backends
+	}
+	if len(backends) > 0 {
+		frozenSkippedChanges.WithLabelValues(target.LoadBalancerID, kind.String()).Add(float64(len(backends)))
+	}
+	if change.empty() {
+		delete(f.skipped, key)
+		return
+	}
+	f.skipped[key] = change
+}
+
+// pending 返回有被跳过的变更的 Deployment，并清除它们的记录。
+// 调用方随后重新同步这些 Deployment，仍处于冻结中的变更会重新记录
+func (f *freezeSwitch) pending() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var deployments []string
+	for key, change := range f.skipped {
+		delete(f.skipped, key)
+		if _, ok := seen[change.Deployment]; !ok {
+			seen[change.Deployment] = struct{}{}
+			deployments = append(deployments, change.Deployment)
+		}
+	}
+	sort.Strings(deployments)
+	return deployments
+}
+
+func (f *freezeSwitch) status() FreezeStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := FreezeStatus{Frozen: len(f.sources) > 0, Sources: f.sourcesLocked()}
+	for _, change := range f.skipped {
+		status.SkippedChanges = append(status.SkippedChanges, change)
+	}
+	sort.Slice(status.SkippedChanges, func(i, j int) bool {
+		return status.SkippedChanges[i].String() < status.SkippedChanges[j].String()
+	})
+	return status
+}
+
+// parseConfigMapRef 解析 [namespace/]name，未指定 namespace 时使用控制器所在的 namespace
+func parseConfigMapRef(ref string) (string, string, error) {
+	namespace, name := envString("POD_NAMESPACE", metav1.NamespaceDefault), ref
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid configmap %q, expected [namespace/]name", ref)
+	}
+	return namespace, name, nil
+}
+
+// watchFreezeConfigMap 通过 informer 监听冻结开关 ConfigMap，ConfigMap 不存在时视为未冻结。
+// 冻结解除时调用 onThaw
+func watchFreezeConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace, name string, freeze *freezeSwitch, onThaw func()) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	update := func(obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		if freeze.set(freezeSourceConfigMap, cm.Data[freezeConfigMapKey] == "true") {
+			onThaw()
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+		DeleteFunc: func(interface{}) {
+			if freeze.set(freezeSourceConfigMap, false) {
+				onThaw()
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add freeze configmap event handler: %v", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync freeze configmap %s/%s", namespace, name)
+	}
+	log.Infof("Watching configmap %s/%s for the freeze switch", namespace, name)
+	return nil
+}
+
+// namespaceFreeze 通过 informer 缓存 namespace 上的冻结注解，同步时不再请求 API
+type namespaceFreeze struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   corelisters.NamespaceLister
+}
+
+func newNamespaceFreeze(clientset kubernetes.Interface) *namespaceFreeze {
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	namespaces := factory.Core().V1().Namespaces()
+	return &namespaceFreeze{
+		factory:  factory,
+		informer: namespaces.Informer(),
+		lister:   namespaces.Lister(),
+	}
+}
+
+// start 启动 informer 并等待缓存同步，namespace 上的冻结注解被删除时调用 onThaw
+func (f *namespaceFreeze) start(ctx context.Context, onThaw func()) error {
+	_, err := f.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNs, ok1 := oldObj.(*corev1.Namespace)
+			newNs, ok2 := newObj.(*corev1.Namespace)
+			if ok1 && ok2 && oldNs.Annotations[freezeAnnotation] == "true" && newNs.Annotations[freezeAnnotation] != "true" {
+				log.Infof("Freeze annotation removed from namespace %s", newNs.Name)
+				onThaw()
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add namespace event handler: %v", err)
+	}
+
+	f.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), f.informer.HasSynced) {
+		return fmt.Errorf("failed to sync namespaces")
+	}
+	return nil
+}
+
+// frozen 返回 namespace 上是否设置了冻结注解。namespace 不在缓存中时视为未冻结并记录警告，不影响同步
+func (f *namespaceFreeze) frozen(namespace string) bool {
+	ns, err := f.lister.Get(namespace)
+	if err != nil {
+		log.Warnf("Failed to get namespace %s from cache, ignoring its freeze annotation: %v", namespace, err)
+		return false
+	}
+	return ns.Annotations[freezeAnnotation] == "true"
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFreezeSwitchSet(t *testing.T) {
+	freeze := newFreezeSwitch()
+
+	steps := []struct {
+		source     string
+		frozen     bool
+		wantFrozen bool
+		wantThaw   bool
+	}{
+		{source: freezeSourceConfigMap, frozen: true, wantFrozen: true},
+		{source: freezeSourceAdmin, frozen: true, wantFrozen: true},
+		{source: freezeSourceConfigMap, frozen: false, wantFrozen: true},
+		{source: freezeSourceAdmin, frozen: false, wantFrozen: false, wantThaw: true},
+		{source: freezeSourceAdmin, frozen: false, wantFrozen: false},
+	}
+
+	for i, step := range steps {
+		if thaw := freeze.set(step.source, step.frozen); thaw != step.wantThaw {
+			t.Errorf("step %d: set(%s, %t) = %t, want %t", i, step.source, step.frozen, thaw, step.wantThaw)
+		}
+		if got := freeze.frozen(); got != step.wantFrozen {
+			t.Errorf("step %d: frozen() = %t, want %t", i, got, step.wantFrozen)
+		}
+	}
+}
+
+func TestFreezeSwitchSkip(t *testing.T) {
+	freeze := newFreezeSwitch()
+	freeze.set(freezeSourceAdmin, true)
+
+	other := testTarget
+	other.LocationID = "loc-2"
+	freeze.skip(testTarget, "default/web", mutationRegister, []string{"10.0.0.1"})
+	freeze.skip(testTarget, "default/web", mutationDeregister, []string{"10.0.0.2:8080"})
+	freeze.skip(other, "default/api", mutationModifyWeight, []string{"10.0.0.3:8080=50"})
+	// 没有变更的类别会被清除
+	freeze.skip(other, "default/api", mutationRegister, nil)
+
+	want := FreezeStatus{
+		Frozen:  true,
+		Sources: []string{freezeSourceAdmin},
+		SkippedChanges: []FrozenChange{
+			{Deployment: "default/web", LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-1", Port: 8080,
+				Register: []string{"10.0.0.1"}, Deregister: []string{"10.0.0.2:8080"}},
+			{Deployment: "default/api", LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-2", Port: 8080,
+				ModifyWeight: []string{"10.0.0.3:8080=50"}},
+		},
+	}
+	if got := freeze.status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("status() = %+v, want %+v", got, want)
+	}
+
+	freeze.skip(other, "default/api", mutationModifyWeight, nil)
+	if got := freeze.pending(); !reflect.DeepEqual(got, []string{"default/web"}) {
+		t.Errorf("pending() = %v, want [default/web]", got)
+	}
+	if got := freeze.status().SkippedChanges; len(got) != 0 {
+		t.Errorf("skipped changes after pending() = %v, want none", got)
+	}
+}
+
+func TestNamespaceFreeze(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Annotations: map[string]string{freezeAnnotation: "true"},
+	}}
+	clientset := fake.NewSimpleClientset(ns)
+	thawed := make(chan struct{}, 1)
+	f := newNamespaceFreeze(clientset)
+	if err := f.start(ctx, func() { thawed <- struct{}{} }); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	if !f.frozen("team-a") {
+		t.Error("frozen(team-a) = false, want true")
+	}
+	// 缓存中没有的 namespace 视为未冻结，不影响同步
+	if f.frozen("missing") {
+		t.Error("frozen(missing) = true, want false")
+	}
+
+	ns = ns.DeepCopy()
+	delete(ns.Annotations, freezeAnnotation)
+	if _, err := clientset.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	select {
+	case <-thawed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onThaw not called after the freeze annotation was removed")
+	}
+	if f.frozen("team-a") {
+		t.Error("frozen(team-a) = true after the annotation was removed, want false")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// 集群名称变量，同一份规则模板可以通过 ${CLUSTER_NAME} 区分不同集群
+const clusterNameVariable = "CLUSTER_NAME"
+
+// 规则文件中除集群名称外只能引用带此前缀的变量，以免通过规则读取凭证等其他环境变量
+const rulesVariablePrefix = "RULES_VAR_"
+
+// clusterName 由 -cluster-name 参数设置，为空时使用 CLUSTER_NAME 环境变量
+var clusterName string
+
+// 规则文件中的变量引用：$$、${NAME} 或 ${NAME:-default}
+var variablePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// lookupRulesVariable 返回规则文件中变量的值，集群名称优先使用 -cluster-name 参数，其余变量读取环境变量
+func lookupRulesVariable(name string) (string, bool) {
+	if name == clusterNameVariable && clusterName != "" {
+		return clusterName, true
+	}
+	return os.LookupEnv(name)
+}
+
+// rulesVariableAllowed 返回规则文件是否可以引用该变量
+func rulesVariableAllowed(name string) bool {
+	return name == clusterNameVariable || strings.HasPrefix(name, rulesVariablePrefix)
+}
+
+// interpolateRules 在解析之前替换规则文件中的变量引用，只能引用 CLUSTER_NAME 和 RULES_VAR_ 开头的变量。未设置（或为空）的变量使用 :- 之后的默认值，
+// 没有默认值时报错；$$ 表示字面的 $。变量的值不能包含换行，以免改变文件结构和错误行号
+func interpolateRules(data []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	var errs ValidationErrors
+	var out bytes.Buffer
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		lineNo := i + 1
+		last := 0
+		for _, match := range variablePattern.FindAllSubmatchIndex(line, -1) {
+			out.Write(line[last:match[0]])
+			last = match[1]
+
+			if match[2] < 0 {
+				out.WriteByte('$')
+				continue
+			}
+			name := string(line[match[2]:match[3]])
+			if !rulesVariableAllowed(name) {
+				errs = append(errs, ValidationError{Line: lineNo, Message: fmt.Sprintf("variable %s is not allowed, only %s and %s* variables can be used", name, clusterNameVariable, rulesVariablePrefix)})
+				continue
+			}
+			value, ok := lookup(name)
+			if !ok || value == "" {
+				if match[4] < 0 {
+					errs = append(errs, ValidationError{Line: lineNo, Message: fmt.Sprintf("variable %s is not set", name)})
+					continue
+				}
+				value = string(line[match[6]:match[7]])
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				errs = append(errs, ValidationError{Line: lineNo, Message: fmt.Sprintf("value of variable %s must not contain a newline", name)})
+				continue
+			}
+			out.WriteString(value)
+		}
+		out.Write(line[last:])
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return out.Bytes(), nil
+}
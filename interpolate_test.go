@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateRules(t *testing.T) {
+	vars := map[string]string{
+		"RULES_VAR_LB_ID":     "lb-abcd1234",
+		"RULES_VAR_EMPTY":     "",
+		"RULES_VAR_MULTILINE": "a\nb",
+		"CLUSTER_NAME":        "prod",
+		"ADMIN_TOKEN":         "secret",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		want      string
+		wantLines []int
+	}{
+		{
+			name: "plain",
+			data: "domain: example.com\n",
+			want: "domain: example.com\n",
+		},
+		{
+			name: "variables",
+			data: "- load_balancer_id: ${RULES_VAR_LB_ID}\n  domain: ${CLUSTER_NAME}.example.com\n",
+			want: "- load_balancer_id: lb-abcd1234\n  domain: prod.example.com\n",
+		},
+		{
+			name: "defaults",
+			data: "a: ${RULES_VAR_MISSING:-fallback}\nb: ${RULES_VAR_EMPTY:-x}\nc: ${RULES_VAR_LB_ID:-unused}\nd: ${RULES_VAR_MISSING:-}\n",
+			want: "a: fallback\nb: x\nc: lb-abcd1234\nd: \n",
+		},
+		{
+			name: "escaped dollar",
+			data: "url: /$${RULES_VAR_LB_ID}/$1\n",
+			want: "url: /${RULES_VAR_LB_ID}/$1\n",
+		},
+		{
+			name:      "unset variables",
+			data:      "a: ${RULES_VAR_LB_ID}\nb: ${RULES_VAR_MISSING}\nc: ${RULES_VAR_EMPTY}\n",
+			wantLines: []int{2, 3},
+		},
+		{
+			name:      "variables outside the allowlist",
+			data:      "a: ${ADMIN_TOKEN}\nb: ${HOME:-x}\nc: ${RULES_VAR_LB_ID}\n",
+			wantLines: []int{1, 2},
+		},
+		{
+			name:      "newline in value",
+			data:      "a: ${RULES_VAR_MULTILINE}\n",
+			wantLines: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateRules([]byte(tt.data), lookup)
+			if tt.wantLines != nil {
+				var errs ValidationErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("interpolateRules() error = %v, want ValidationErrors", err)
+				}
+				var lines []int
+				for _, e := range errs {
+					lines = append(lines, e.Line)
+				}
+				if !reflect.DeepEqual(lines, tt.wantLines) {
+					t.Errorf("interpolateRules() error lines = %v, want %v (%v)", lines, tt.wantLines, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolateRules() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("interpolateRules() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRulesInterpolatesClusterName(t *testing.T) {
+	clusterName = "staging"
+	defer func() { clusterName = "" }()
+
+	data := strings.Replace(validRules, "test.example.com", "${CLUSTER_NAME}.example.com", 1)
+	rules, err := parseRules([]byte(data))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+	if got := rules[0].Listeners[0].Rules[0].Domain; got != "staging.example.com" {
+		t.Errorf("domain = %q, want staging.example.com", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 日志格式
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// 时间戳格式与原有文本日志保持一致
+const logTimestampFormat = "2006-01-02 15:04:05"
+
+// configureLogging 设置日志格式和级别
+func configureLogging(format, level string) error {
+	switch format {
+	case logFormatText:
+		log.SetFormatter(&log.TextFormatter{
+			TimestampFormat: logTimestampFormat,
+			FullTimestamp:   true,
+		})
+	case logFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid log format %q, expected %s or %s", format, logFormatText, logFormatJSON)
+	}
+
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %v", level, err)
+	}
+	log.SetLevel(parsed)
+	return nil
+}
+
+// setLogLevel 在运行时修改日志级别
+func setLogLevel(level string) error {
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %v", level, err)
+	}
+	if parsed != log.GetLevel() {
+		log.Warnf("Log level changed from %s to %s", log.GetLevel(), parsed)
+		log.SetLevel(parsed)
+	}
+	return nil
+}
+
+// debugToggle 在收到 SIGUSR1 时在 debug 和启动时的日志级别之间切换
+type debugToggle struct {
+	mu       sync.Mutex
+	previous log.Level
+}
+
+func (d *debugToggle) toggle() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if log.GetLevel() != log.DebugLevel {
+		d.previous = log.GetLevel()
+		setLogLevel(log.DebugLevel.String())
+		return
+	}
+	// 启动时已经是 debug 级别时切换到 info
+	if d.previous == log.DebugLevel {
+		d.previous = log.InfoLevel
+	}
+	setLogLevel(d.previous.String())
+}
+
+// watchLogLevelSignal 监听 SIGUSR1 切换 debug 日志
+func watchLogLevelSignal(ctx context.Context) {
+	toggle := &debugToggle{previous: log.GetLevel()}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			toggle.toggle()
+		}
+	}
+}
+
+// syncLogger 返回带有同步上下文字段的日志记录器
+func syncLogger(namespace, deploymentName, eventType, podName string, target ConfigTarget) *log.Entry {
+	fields := log.Fields{
+		"namespace":  namespace,
+		"deployment": deploymentName,
+		"event":      eventType,
+		"lb":         target.LoadBalancerID,
+		"listener":   target.ListenerID,
+		"location":   target.LocationID,
+	}
+	if podName != "" {
+		fields["pod"] = podName
+	}
+	return log.WithFields(fields)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// restoreLogging 在测试结束后恢复全局日志配置
+func restoreLogging(t *testing.T) {
+	formatter, level := log.StandardLogger().Formatter, log.GetLevel()
+	t.Cleanup(func() {
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+	})
+}
+
+func TestConfigureLogging(t *testing.T) {
+	restoreLogging(t)
+
+	tests := []struct {
+		name      string
+		format    string
+		level     string
+		wantErr   bool
+		wantLevel log.Level
+		wantJSON  bool
+	}{
+		{name: "text info", format: "text", level: "info", wantLevel: log.InfoLevel},
+		{name: "json debug", format: "json", level: "debug", wantLevel: log.DebugLevel, wantJSON: true},
+		{name: "upper case level", format: "text", level: "WARN", wantLevel: log.WarnLevel},
+		{name: "invalid format", format: "xml", level: "info", wantErr: true},
+		{name: "invalid level", format: "text", level: "verbose", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := configureLogging(tt.format, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configureLogging() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := log.GetLevel(); got != tt.wantLevel {
+				t.Errorf("level = %s, want %s", got, tt.wantLevel)
+			}
+			if _, isJSON := log.StandardLogger().Formatter.(*log.JSONFormatter); isJSON != tt.wantJSON {
+				t.Errorf("JSON formatter = %t, want %t", isJSON, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestDebugToggle(t *testing.T) {
+	restoreLogging(t)
+
+	log.SetLevel(log.WarnLevel)
+	toggle := &debugToggle{previous: log.WarnLevel}
+	for i, want := range []log.Level{log.DebugLevel, log.WarnLevel, log.DebugLevel} {
+		toggle.toggle()
+		if got := log.GetLevel(); got != want {
+			t.Errorf("toggle %d: level = %s, want %s", i+1, got, want)
+		}
+	}
+
+	// 启动时已经是 debug 级别
+	log.SetLevel(log.DebugLevel)
+	toggle = &debugToggle{previous: log.DebugLevel}
+	toggle.toggle()
+	if got := log.GetLevel(); got != log.InfoLevel {
+		t.Errorf("level = %s, want info", got)
+	}
+}
+
+func TestSyncLogger(t *testing.T) {
+	entry := syncLogger("default", "web", "ADDED", "web-1", testTarget)
+	want := log.Fields{
+		"namespace":  "default",
+		"deployment": "web",
+		"event":      "ADDED",
+		"pod":        "web-1",
+		"lb":         "lb-00000001",
+		"listener":   "lbl-1",
+		"location":   "loc-1",
+	}
+	for key, value := range want {
+		if entry.Data[key] != value {
+			t.Errorf("field %s = %v, want %v", key, entry.Data[key], value)
+		}
+	}
+
+	if _, ok := syncLogger("default", "web", "RELOAD", "", testTarget).Data["pod"]; ok {
+		t.Errorf("pod field should be omitted when the sync was not triggered by a pod")
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,15 +19,39 @@ import (
 	"k8s.io/client-go/kubernetes"
 	// "k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 type PodController struct {
 	clientset *kubernetes.Clientset
-	tencent   *TencentClient
+	tencent   *TencentClientPool
 	config    *Config
+
+	slowStart         *slowStartTracker
+	slowStartInterval time.Duration
+	budget            *deregistrationBudget
+
+	freeze *freezeSwitch
+	// namespace 上的冻结注解
+	namespaceFreeze *namespaceFreeze
+	// 冻结开关 ConfigMap，为空时不监听
+	freezeConfigMapNamespace string
+	freezeConfigMapName      string
+	// 冻结解除或绑定恢复时通知重新同步被跳过的变更
+	thaw chan struct{}
+	// 冻结开关 ConfigMap 和 namespace 注解同步完成后关闭
+	freezeSynced chan struct{}
+	// 通过管理接口暂停的绑定
+	paused *pausedBindings
+	audit  *auditLogger
+	// 按 namespace/deployment 串行化同步。Pod 事件、规则重载、慢启动、解绑预算、冻结解除和
+	// 管理接口各自触发同步，同时同步同一 Deployment 会基于相同的状态发送重复的变更
+	syncLocks *keyedLocks
+	// 记录 Deployment 上的事件
+	recorder record.EventRecorder
 }
 
-func NewPodController() (*PodController, error) {
+func NewPodController(ctx context.Context, rules rulesOptions) (*PodController, error) {
     // 加载 kubeconfig
 	// config, err := clientcmd.BuildConfigFromFlags("", "./kube-config")
 
@@ -41,21 +68,73 @@ func NewPodController() (*PodController, error) {
 	}
 
 	// 创建腾讯云客户端
-	tencent, err := NewTencentClient()
+	tencent, err := NewTencentClientPool(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tencent client: %v", err)
 	}
 
 	// 加载配置
-	cfg, err := LoadConfig()
+	source, err := newRulesSource(clientset, rules)
+	if err != nil {
+		return nil, err
+	}
+	stateNamespace, stateName, err := parseConfigMapRef(envString("ADMIN_STATE_CONFIGMAP", defaultAdminStateConfigMap))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ADMIN_STATE_CONFIGMAP: %v", err)
+	}
+	cfg, err := LoadConfig(tencent, source, newRuleOwnersStore(clientset, stateNamespace, stateName))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %v", err)
 	}
 
+	slowStartInterval, err := envDuration("SLOW_START_INTERVAL", defaultSlowStartInterval)
+	if err != nil {
+		return nil, err
+	}
+	if slowStartInterval <= 0 {
+		return nil, fmt.Errorf("SLOW_START_INTERVAL must be greater than 0")
+	}
+	budget, err := deregistrationBudgetFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	paused := newPausedBindings(clientset, stateNamespace, stateName)
+	if err := paused.load(); err != nil {
+		return nil, err
+	}
+
+	audit, err := newAuditLoggerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var freezeNamespace, freezeName string
+	if ref := os.Getenv("FREEZE_CONFIGMAP"); ref != "" {
+		freezeNamespace, freezeName, err = parseConfigMapRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FREEZE_CONFIGMAP: %v", err)
+		}
+	}
+
 	return &PodController{
-		clientset: clientset,
-		tencent:   tencent,
-		config:    cfg,
+		clientset:         clientset,
+		tencent:           tencent,
+		config:            cfg,
+		slowStart:         newSlowStartTracker(),
+		slowStartInterval: slowStartInterval,
+		budget:            budget,
+
+		freeze:                   newFreezeSwitch(),
+		namespaceFreeze:          newNamespaceFreeze(clientset),
+		freezeConfigMapNamespace: freezeNamespace,
+		freezeConfigMapName:      freezeName,
+		thaw:                     make(chan struct{}, 1),
+		freezeSynced:             make(chan struct{}),
+		paused:                   paused,
+		audit:                    audit,
+		syncLocks:                newKeyedLocks(),
+		recorder:                 newEventRecorder(clientset),
 	}, nil
 }
 
@@ -67,15 +146,27 @@ func (pc *PodController) formatLabels(labels map[string]string) string {
 	return strings.Join(pairs, ",")
 }
 
-func (pc *PodController) getPodIPs(namespace, deploymentName string) ([]string, error) {
+// deploymentPods 是 Deployment 下的 Pod 及同步时需要的注解
+type deploymentPods struct {
+	ips []string
+	// 设置了权重注解的 Pod 的权重
+	weights map[string]int
+	// Deployment 设置了跳过解绑安全限制的注解
+	overrideSafety bool
+	// Deployment 上设置了冻结注解
+	frozen bool
+}
+
+// getPodIPs 返回 Deployment 下所有 Pod 的 IP 和权重注解
+func (pc *PodController) getPodIPs(namespace, deploymentName string) (deploymentPods, error) {
 	if deploymentName == "" {
-		return []string{}, nil
+		return deploymentPods{ips: []string{}}, nil
 	}
 
 	// 获取 Deployment
 	deployment, err := pc.clientset.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get deployment %s/%s: %v", namespace, deploymentName, err)
+		return deploymentPods{}, fmt.Errorf("failed to get deployment %s/%s: %v", namespace, deploymentName, err)
 	}
 
 	// 根据 Deployment 的 selector 获取 Pods
@@ -84,17 +175,25 @@ func (pc *PodController) getPodIPs(namespace, deploymentName string) ([]string,
 		LabelSelector: labelSelector,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pods: %v", err)
+		return deploymentPods{}, fmt.Errorf("failed to list pods: %v", err)
 	}
 
-	var ips []string
-	for _, pod := range pods.Items {
+	result := deploymentPods{
+		weights:        make(map[string]int),
+		overrideSafety: deployment.Annotations[deregistrationOverrideAnnotation] == "true",
+		frozen:         deployment.Annotations[freezeAnnotation] == "true",
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
 		if pod.Status.PodIP != "" {
-			ips = append(ips, pod.Status.PodIP)
+			result.ips = append(result.ips, pod.Status.PodIP)
+			if weight := podWeight(pod); weight != nil {
+				result.weights[pod.Status.PodIP] = *weight
+			}
 		}
 	}
 
-	return ips, nil
+	return result, nil
 }
 
 func (pc *PodController) getDeploymentName(pod *corev1.Pod) (string, error) {
@@ -124,11 +223,9 @@ func (pc *PodController) getDeploymentName(pod *corev1.Pod) (string, error) {
 }
 
 func (pc *PodController) syncPodToLB(namespace, deploymentName, eventType, podName string) error {
-	// 获取当前 Pod IPs
-	podIPs, err := pc.getPodIPs(namespace, deploymentName)
-	if err != nil {
-		return fmt.Errorf("failed to get pod IPs: %v", err)
-	}
+	// 同一 Deployment 的同步依次执行，后一次同步基于前一次记录的后端计算变更
+	unlock := pc.syncLocks.lock(fmt.Sprintf("%s/%s", namespace, deploymentName))
+	defer unlock()
 
 	// 获取配置中的目标
 	targets := pc.config.GetTargets(fmt.Sprintf("%s/%s", namespace, deploymentName))
@@ -136,75 +233,381 @@ func (pc *PodController) syncPodToLB(namespace, deploymentName, eventType, podNa
 		return nil // 没有配置，跳过
 	}
 
+	// 获取当前 Pod IPs
+	pods, err := pc.getPodIPs(namespace, deploymentName)
+	if err != nil {
+		return fmt.Errorf("failed to get pod IPs: %v", err)
+	}
+
+	// 不同负载均衡器的绑定并行处理，同一负载均衡器的变更由腾讯云客户端合并并串行执行
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
 	for _, target := range targets {
-		loadBalancerID := target.LoadBalancerID
-		backendKey := fmt.Sprintf("%s/%s/%s/%s/%s", namespace, deploymentName, loadBalancerID, target.ListenerID, target.LocationID)
+		wg.Add(1)
+		go func(target ConfigTarget) {
+			defer wg.Done()
+			var err error
+			if target.Split != nil {
+				err = pc.syncSplitTarget(namespace, deploymentName, eventType, podName, pods, target)
+			} else {
+				err = pc.syncTarget(namespace, deploymentName, eventType, podName, pods, nil, target)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
 
-		// 获取当前后端 IPs
-		backendIPs := pc.config.GetBackendIPs(backendKey)
+	return errors.Join(errs...)
+}
 
-		// 添加新 IP
-		newIPs := difference(podIPs, backendIPs)
+// syncSplitTarget 同步按比例分配流量的转发规则：根据每个后端的比例和 Pod 数量计算权重，
+// 绑定当前 Deployment 的 Pod，并调整其他后端已绑定的 Pod 的权重
+func (pc *PodController) syncSplitTarget(namespace, deploymentName, eventType, podName string, pods deploymentPods, target ConfigTarget) error {
+	own := fmt.Sprintf("%s/%s", namespace, deploymentName)
+	members := map[string]deploymentPods{own: pods}
+	counts := map[string]int{own: len(pods.ips)}
+	for _, member := range target.Split {
+		key := member.key()
+		if key == own {
+			continue
+		}
+		memberPods, err := pc.getPodIPs(member.Namespace, member.Deployment)
+		if err != nil {
+			return fmt.Errorf("failed to get pod IPs of %s: %v", key, err)
+		}
+		members[key] = memberPods
+		counts[key] = len(memberPods.ips)
+	}
+	weights := splitWeights(target.Split, counts)
+
+	// 其他后端的 Pod 不能被当作旧后端解绑
+	var keep []string
+	for _, member := range target.Split {
+		if member.key() == own {
+			continue
+		}
+		for _, ip := range members[member.key()].ips {
+			keep = append(keep, fmt.Sprintf("%s:%d", ip, member.Port))
+		}
+	}
+
+	var errs []error
+	for _, member := range target.Split {
+		memberTarget := target
+		memberTarget.Port = member.Port
+		weight := weights[member.key()]
+		memberTarget.Weight = &weight
+
+		var err error
+		if member.key() == own {
+			err = pc.syncTarget(namespace, deploymentName, eventType, podName, pods, keep, memberTarget)
+		} else {
+			err = pc.syncWeights(member.Namespace, member.Deployment, eventType, podName, members[member.key()], memberTarget)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncTarget 将 Pod IPs 同步到单个负载均衡器转发规则，keep 中的后端（ip:port）不会被解绑
+func (pc *PodController) syncTarget(namespace, deploymentName, eventType, podName string, pods deploymentPods, keep []string, target ConfigTarget) error {
+	loadBalancerID := target.LoadBalancerID
+	deployment := fmt.Sprintf("%s/%s", namespace, deploymentName)
+	frozen := pc.frozen(namespace, deploymentName, pods, target)
+	trigger := auditTrigger{event: eventType, pod: podName, namespace: namespace, deployment: deploymentName}
+	logger := syncLogger(namespace, deploymentName, eventType, podName, target)
+	var errs []error
+
+	// 获取当前后端 IPs
+	backendIPs := pc.config.GetBackendIPs(target)
+
+	// 添加新 IP
+	newIPs := difference(pods.ips, backendIPs)
+	if frozen {
+		pc.freeze.skip(target, deployment, mutationRegister, newIPs)
 		if len(newIPs) > 0 {
-			log.Infof("%s %s %s %s %s %s Adding new backend: %v",
-				time.Now().Format("2006-01-02T15:04:05"),
-				namespace, deploymentName, eventType, podName, loadBalancerID, newIPs)
+			logger.Warnf("Frozen or paused, skipping registration of: %v", newIPs)
+		}
+	} else if len(newIPs) > 0 {
+		logger.Infof("Adding new backend: %v", newIPs)
+
+		var registerTargets []RegisterTarget
+		var registerBackends []Backend
+		var auditTargets []AuditTarget
+		registerWeights := make(map[Backend]int)
+		for _, ip := range newIPs {
+			if target.SlowStart > 0 {
+				pc.slowStart.start(target, deployment, ip)
+			}
+			weight := pc.desiredWeight(target, pods.weights, ip)
+			registerTargets = append(registerTargets, RegisterTarget{
+				LoadBalancerID: target.LoadBalancerID,
+				ListenerID:     target.ListenerID,
+				LocationID:     target.LocationID,
+				Port:           target.Port,
+				EniIP:          ip,
+				Weight:         weight,
+			})
+			auditTargets = append(auditTargets, AuditTarget{IP: ip, Port: target.Port, Weight: weight})
+			backend := Backend{IP: ip, Port: target.Port}
+			registerBackends = append(registerBackends, backend)
+			registerWeights[backend] = defaultTargetWeight
+			if weight != nil {
+				registerWeights[backend] = *weight
+			}
+		}
+
+		start := time.Now()
+		requestIDs, err := pc.tencent.BatchRegisterTargets(loadBalancerID, registerTargets)
+		pc.audit.record(trigger, target, mutationRegister, auditTargets, requestIDs, err, start)
+		if err != nil {
+			logger.Errorf("Failed to register targets: %v", err)
+			errs = append(errs, fmt.Errorf("failed to register targets: %w", err))
+		}
+		// 只记录异步任务已完成的后端
+		registered := succeededBackends(registerBackends, err)
+		pc.config.RecordRegistered(target, registered)
+		pc.config.RecordWeights(target, weightsOf(registered, registerWeights))
+	}
+
+	// 调整已绑定后端的权重
+	if err := pc.syncWeights(namespace, deploymentName, eventType, podName, pods, target); err != nil {
+		errs = append(errs, err)
+	}
+
+	// 删除旧 IP
+	backendIPPorts := pc.config.GetBackendIPPorts(target)
+	backendChangePortIPs := pc.config.GetBackendChangePortIPs(target)
+	podIPPorts := make([]string, len(pods.ips))
+	for i, ip := range pods.ips {
+		podIPPorts[i] = fmt.Sprintf("%s:%d", ip, target.Port)
+	}
+
+	oldIPs := difference(intersection(difference(backendIPPorts, podIPPorts), backendChangePortIPs), keep)
+
+	// 冻结时只记录需要解绑的后端
+	if frozen {
+		pc.freeze.skip(target, deployment, mutationDeregister, oldIPs)
+		if len(oldIPs) > 0 {
+			logger.Warnf("Frozen or paused, skipping deregistration of: %v", oldIPs)
+		}
+		return errors.Join(errs...)
+	}
+
+	// 解绑数量违反安全限制时阻止本次解绑，需在 Deployment 上设置注解才能跳过
+	if err := target.Safety.check(len(backendIPPorts), len(oldIPs)); err != nil {
+		if pods.overrideSafety {
+			logger.Warnf("Deregistration safety limit overridden: %v", err)
+		} else {
+			logger.Errorf("Blocked deregistration of %v: %v", oldIPs, err)
+			deregistrationBlocked.WithLabelValues(loadBalancerID).Inc()
+			pc.recordDeregistrationBlocked(namespace, deploymentName, target, err)
+			errs = append(errs, fmt.Errorf("deregistration blocked: %w", err))
+			oldIPs = nil
+		}
+	}
+
+	// 超出解绑预算的后端排队，等待预算恢复后再解绑
+	if allowed := pc.budget.take(loadBalancerID, len(oldIPs)); allowed < len(oldIPs) {
+		logger.Warnf("Deregistration budget exhausted, deferring %v", oldIPs[allowed:])
+		pc.budget.queue(target, deployment, oldIPs[allowed:])
+		oldIPs = oldIPs[:allowed]
+	} else {
+		pc.budget.queue(target, deployment, nil)
+	}
 
-			var registerTargets []RegisterTarget
-			for _, ip := range newIPs {
-				registerTargets = append(registerTargets, RegisterTarget{
+	if len(oldIPs) > 0 {
+		logger.Infof("Removing old backend: %v", oldIPs)
+
+		var deregisterTargets []DeregisterTarget
+		var deregisterBackends []Backend
+		var auditTargets []AuditTarget
+		currentWeights := pc.config.GetBackendWeights(target)
+		for _, ipPort := range oldIPs {
+			parts := strings.Split(ipPort, ":")
+			if len(parts) == 2 {
+				port := 0
+				fmt.Sscanf(parts[1], "%d", &port)
+				deregisterTargets = append(deregisterTargets, DeregisterTarget{
 					LoadBalancerID: target.LoadBalancerID,
 					ListenerID:     target.ListenerID,
 					LocationID:     target.LocationID,
-					Port:           target.Port,
-					EniIP:          ip,
+					EniIP:          parts[0],
+					Port:           port,
 				})
+				backend := Backend{IP: parts[0], Port: port}
+				deregisterBackends = append(deregisterBackends, backend)
+				auditTarget := AuditTarget{IP: parts[0], Port: port}
+				if weight, ok := currentWeights[backend]; ok {
+					auditTarget.Weight = &weight
+				}
+				auditTargets = append(auditTargets, auditTarget)
 			}
+		}
 
-			err := pc.tencent.BatchRegisterTargets(loadBalancerID, registerTargets)
-			if err != nil {
-				log.Errorf("Failed to register targets: %v", err)
+		start := time.Now()
+		requestIDs, err := pc.tencent.BatchDeregisterTargets(loadBalancerID, deregisterTargets)
+		pc.audit.record(trigger, target, mutationDeregister, auditTargets, requestIDs, err, start)
+		if err != nil {
+			logger.Errorf("Failed to deregister targets: %v", err)
+			errs = append(errs, fmt.Errorf("failed to deregister targets: %w", err))
+		}
+		pc.config.RecordDeregistered(target, succeededBackends(deregisterBackends, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// desiredWeight 返回 Pod 的期望权重，处于慢启动中的 Pod 返回当前的慢启动权重。
+// 配置了慢启动但未指定权重时，以 CLB 默认权重为完整权重
+func (pc *PodController) desiredWeight(target ConfigTarget, podWeights map[string]int, ip string) *int {
+	weight := targetWeight(target, podWeights, ip)
+	if target.SlowStart <= 0 {
+		return weight
+	}
+	full := defaultTargetWeight
+	if weight != nil {
+		full = *weight
+	}
+	ramped := pc.slowStart.weight(target, ip, full)
+	return &ramped
+}
+
+// runSlowStart 定期同步有后端处于慢启动中的 Deployment，逐步提高这些后端的权重
+func (pc *PodController) runSlowStart(ctx context.Context) {
+	ticker := time.NewTicker(pc.slowStartInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, key := range pc.slowStart.active() {
+			parts := strings.SplitN(key, "/", 2)
+			if err := pc.syncPodToLB(parts[0], parts[1], "SLOWSTART", ""); err != nil {
+				log.Errorf("Failed to update slow start weights of %s: %v", key, err)
 			}
 		}
+	}
+}
+
+// runDeregistrationBudget 定期同步有排队中的解绑的 Deployment，在预算恢复后继续解绑
+func (pc *PodController) runDeregistrationBudget(ctx context.Context) {
+	ticker := time.NewTicker(deregistrationBudgetInterval)
+	defer ticker.Stop()
 
-		// 删除旧 IP
-		backendIPPorts := pc.config.GetBackendIPPorts(backendKey)
-		backendChangePortIPs := pc.config.GetBackendChangePortIPs(backendKey, target.Port)
-		podIPPorts := make([]string, len(podIPs))
-		for i, ip := range podIPs {
-			podIPPorts[i] = fmt.Sprintf("%s:%d", ip, target.Port)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 
-		oldIPs := intersection(difference(backendIPPorts, podIPPorts), backendChangePortIPs)
-		if len(oldIPs) > 0 {
-			log.Infof("%s %s %s %s %s %s Removing old backend: %v",
-				time.Now().Format("2006-01-02T15:04:05"),
-				namespace, deploymentName, eventType, podName, loadBalancerID, oldIPs)
-
-			var deregisterTargets []DeregisterTarget
-			for _, ipPort := range oldIPs {
-				parts := strings.Split(ipPort, ":")
-				if len(parts) == 2 {
-					port := 0
-					fmt.Sscanf(parts[1], "%d", &port)
-					deregisterTargets = append(deregisterTargets, DeregisterTarget{
-						LoadBalancerID: target.LoadBalancerID,
-						ListenerID:     target.ListenerID,
-						LocationID:     target.LocationID,
-						EniIP:          parts[0],
-						Port:           port,
-					})
-				}
+		deployments, now := pc.budget.pending()
+		for _, key := range deployments {
+			parts := strings.SplitN(key, "/", 2)
+			if err := pc.syncPodToLB(parts[0], parts[1], "BUDGET", ""); err != nil {
+				log.Errorf("Failed to apply queued deregistrations of %s: %v", key, err)
+				continue
 			}
+			pc.budget.prune(key, now)
+		}
+	}
+}
 
-			err := pc.tencent.BatchDeregisterTargets(loadBalancerID, deregisterTargets)
-			if err != nil {
-				log.Errorf("Failed to deregister targets: %v", err)
+// frozen 返回是否冻结了 Deployment 的变更，或通过管理接口暂停了该绑定
+func (pc *PodController) frozen(namespace, deploymentName string, pods deploymentPods, target ConfigTarget) bool {
+	return pods.frozen || pc.freeze.frozen() || pc.namespaceFreeze.frozen(namespace) || pc.paused.has(bindingKeyOf(namespace, deploymentName, target))
+}
+
+// SetFrozen 通过管理接口开启或关闭全局冻结
+func (pc *PodController) SetFrozen(frozen bool) {
+	if pc.freeze.set(freezeSourceAdmin, frozen) {
+		pc.notifyThaw()
+	}
+}
+
+func (pc *PodController) notifyThaw() {
+	select {
+	case pc.thaw <- struct{}{}:
+	default:
+	}
+}
+
+// runFreeze 定期重新同步有被跳过的变更的 Deployment，冻结解除时立即同步，执行冻结期间被跳过的变更
+func (pc *PodController) runFreeze(ctx context.Context) {
+	ticker := time.NewTicker(freezeResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-pc.thaw:
+			log.Info("Freeze lifted or binding resumed, applying skipped changes")
+		}
+
+		for _, key := range pc.freeze.pending() {
+			parts := strings.SplitN(key, "/", 2)
+			if err := pc.syncPodToLB(parts[0], parts[1], "FREEZE", ""); err != nil {
+				log.Errorf("Failed to sync %s after freeze: %v", key, err)
 			}
 		}
 	}
+}
 
-	return nil
+// syncWeights 将已绑定的 Pod 的权重调整为期望权重
+func (pc *PodController) syncWeights(namespace, deploymentName, eventType, podName string, pods deploymentPods, target ConfigTarget) error {
+	logger := syncLogger(namespace, deploymentName, eventType, podName, target)
+	weightFor := func(ip string) *int { return pc.desiredWeight(target, pods.weights, ip) }
+	weightTargets := weightChanges(target, pods.ips, weightFor, pc.config.GetBackendWeights(target))
+	if pc.frozen(namespace, deploymentName, pods, target) {
+		pc.freeze.skip(target, fmt.Sprintf("%s/%s", namespace, deploymentName), mutationModifyWeight, formatWeightTargets(weightTargets))
+		if len(weightTargets) > 0 {
+			logger.Warnf("Frozen or paused, skipping weight changes: %v", formatWeightTargets(weightTargets))
+		}
+		return nil
+	}
+	if len(weightTargets) == 0 {
+		return nil
+	}
+
+	logger.Infof("Modifying backend weights: %v", formatWeightTargets(weightTargets))
+
+	var weightBackends []Backend
+	var auditTargets []AuditTarget
+	weights := make(map[Backend]int)
+	for _, t := range weightTargets {
+		backend := Backend{IP: t.EniIP, Port: t.Port}
+		weightBackends = append(weightBackends, backend)
+		weights[backend] = t.Weight
+		weight := t.Weight
+		auditTargets = append(auditTargets, AuditTarget{IP: t.EniIP, Port: t.Port, Weight: &weight})
+	}
+
+	start := time.Now()
+	requestIDs, err := pc.tencent.BatchModifyTargetWeight(target.LoadBalancerID, weightTargets)
+	pc.audit.record(auditTrigger{event: eventType, pod: podName, namespace: namespace, deployment: deploymentName},
+		target, mutationModifyWeight, auditTargets, requestIDs, err, start)
+	if err != nil {
+		logger.Errorf("Failed to modify target weights: %v", err)
+		err = fmt.Errorf("failed to modify target weights: %w", err)
+	}
+	pc.config.RecordWeights(target, weightsOf(succeededBackends(weightBackends, err), weights))
+	return err
 }
 
 func (pc *PodController) watchPods(ctx context.Context) error {
@@ -248,7 +651,7 @@ func (pc *PodController) watchPods(ctx context.Context) error {
 
 			deploymentName, err := pc.getDeploymentName(pod)
 			if err != nil {
-				log.Errorf("Failed to get deployment name for pod %s/%s: %v", namespace, podName, err)
+				log.WithFields(log.Fields{"namespace": namespace, "pod": podName}).Errorf("Failed to get deployment name: %v", err)
 				continue
 			}
 
@@ -258,7 +661,8 @@ func (pc *PodController) watchPods(ctx context.Context) error {
 
 			err = pc.syncPodToLB(namespace, deploymentName, eventType, podName)
 			if err != nil {
-				log.Errorf("Failed to sync pod to LB: %v", err)
+				log.WithFields(log.Fields{"namespace": namespace, "deployment": deploymentName, "event": eventType, "pod": podName}).
+					Errorf("Failed to sync pod to LB: %v", err)
 			}
 
 			// log.Infof("===")
@@ -270,10 +674,112 @@ func (pc *PodController) watchPods(ctx context.Context) error {
 	}
 }
 
+// ControllerStatus 是 /status 展示的控制器状态
+type ControllerStatus struct {
+	Rules           RulesStatus      `json:"rules"`
+	UnresolvedRules []UnresolvedRule `json:"unresolved_rules"`
+	Conflicts       []RuleConflict   `json:"conflicts"`
+	Freeze          FreezeStatus     `json:"freeze"`
+}
+
+func (pc *PodController) Status() ControllerStatus {
+	return ControllerStatus{
+		Rules:           pc.config.RulesStatus(),
+		UnresolvedRules: pc.config.UnresolvedRules(),
+		Conflicts:       pc.config.Conflicts(),
+		Freeze:          pc.freeze.status(),
+	}
+}
+
+// Ready 在规则尚未加载或无法获取任何负载均衡器的状态时返回错误。
+// 无效的规则文件、冲突和无法匹配的配置通过 /ready 的响应、/status、指标和日志报告，不影响就绪
+func (pc *PodController) Ready() error {
+	return pc.config.Ready()
+}
+
+// problems 汇总状态中需要处理的问题，没有问题时返回 nil
+func (s ControllerStatus) problems() error {
+	var lines []string
+	for _, file := range s.Rules.Files {
+		if file.Error != "" {
+			lines = append(lines, fmt.Sprintf("invalid rules file %s: %s", file.Name, file.Error))
+		}
+	}
+	for _, conflict := range s.Conflicts {
+		lines = append(lines, fmt.Sprintf("conflicting rule: %s", conflict))
+	}
+	for _, u := range s.UnresolvedRules {
+		lines = append(lines, fmt.Sprintf("unresolved rule: %s", u))
+	}
+	if len(lines) > 0 {
+		return fmt.Errorf("%d problems found:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// reconcile 在规则或负载均衡器状态变化后立即同步目标发生变化的 Deployment
+func (pc *PodController) reconcile(keys []string) {
+	for _, key := range keys {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		log.Infof("Reconciling %s after its targets changed", key)
+		err := pc.syncPodToLB(parts[0], parts[1], "RELOAD", "")
+		if err != nil {
+			log.Errorf("Failed to sync %s after its targets changed: %v", key, err)
+		}
+	}
+}
+
 func (pc *PodController) Run(ctx context.Context) error {
+	// 冻结状态在任何触发同步的后台任务启动之前就绪，启动时已开启的冻结对所有同步生效
+	if err := pc.namespaceFreeze.start(ctx, pc.notifyThaw); err != nil {
+		return err
+	}
+	if pc.freezeConfigMapName != "" {
+		if err := watchFreezeConfigMap(ctx, pc.clientset, pc.freezeConfigMapNamespace, pc.freezeConfigMapName, pc.freeze, pc.notifyThaw); err != nil {
+			return err
+		}
+	}
+	close(pc.freezeSynced)
+
+	// 监听规则文件变化，失败时仍可依靠定期重新加载
+	if err := pc.config.WatchRules(ctx, pc.reconcile); err != nil {
+		log.Warningf("Failed to watch rules file, falling back to periodic reload: %v", err)
+	}
+	pc.config.RunRefresh(ctx, pc.reconcile)
+	go pc.runSlowStart(ctx)
+	go pc.runDeregistrationBudget(ctx)
+	go pc.runFreeze(ctx)
 	return pc.watchPods(ctx)
 }
 
+// 辅助函数：返回批量操作中已成功完成的后端
+func succeededBackends(backends []Backend, err error) []Backend {
+	if err == nil {
+		return backends
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return nil
+	}
+
+	failed := make(map[Backend]struct{}, len(batchErr.Failed))
+	for _, f := range batchErr.Failed {
+		failed[Backend{IP: f.EniIP, Port: f.Port}] = struct{}{}
+	}
+
+	var succeeded []Backend
+	for _, backend := range backends {
+		if _, found := failed[backend]; !found {
+			succeeded = append(succeeded, backend)
+		}
+	}
+	return succeeded
+}
+
 // 辅助函数：计算两个字符串切片的差集
 func difference(a, b []string) []string {
 	mb := make(map[string]struct{}, len(b))
@@ -305,23 +811,44 @@ func intersection(a, b []string) []string {
 }
 
 func main() {
-	// 设置日志格式
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-		FullTimestamp:   true,
-	})
-	log.SetLevel(log.InfoLevel)
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "migrate-config":
+			os.Exit(runMigrateConfig(os.Args[2:]))
+		}
+	}
 
-	// 创建控制器
-	controller, err := NewPodController()
-	if err != nil {
-		log.Fatalf("Failed to create pod controller: %v", err)
+	var rules rulesOptions
+	var logFormat, logLevel string
+	flag.StringVar(&logFormat, "log-format", envString("LOG_FORMAT", logFormatText), "log format, text or json (env LOG_FORMAT)")
+	flag.StringVar(&logLevel, "log-level", envString("LOG_LEVEL", "info"), "log level: panic, fatal, error, warn, info, debug or trace (env LOG_LEVEL)")
+	flag.StringVar(&rules.path, "rules", envString("RULES_FILE", defaultRulesPath), "path to the rules file (env RULES_FILE)")
+	flag.StringVar(&rules.dir, "rules-dir", envString("RULES_DIR", ""), "load and merge every *.yaml file in this directory instead of a single rules file (env RULES_DIR)")
+	flag.StringVar(&rules.configMap, "rules-configmap", envString("RULES_CONFIGMAP", ""), "read rules from this [namespace/]name ConfigMap instead of a file (env RULES_CONFIGMAP)")
+	flag.StringVar(&rules.configMapKey, "rules-configmap-key", envString("RULES_CONFIGMAP_KEY", defaultRulesConfigMapKey), "key of the rules in the ConfigMap (env RULES_CONFIGMAP_KEY)")
+	flag.StringVar(&clusterName, "cluster-name", envString(clusterNameVariable, ""), "cluster name available to rules files as ${CLUSTER_NAME} (env CLUSTER_NAME)")
+	flag.Parse()
+
+	// 设置日志格式和级别
+	if err := configureLogging(logFormat, logLevel); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
 	}
 
 	// 创建上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// 创建控制器
+	controller, err := NewPodController(ctx, rules)
+	if err != nil {
+		log.Fatalf("Failed to create pod controller: %v", err)
+	}
+
 	// 处理信号
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -332,6 +859,21 @@ func main() {
 		cancel()
 	}()
 
+	// SIGUSR1 切换 debug 日志
+	go watchLogLevelSignal(ctx)
+
+	// 启动健康检查与监控指标服务
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = defaultHTTPAddr
+	}
+	// 设置 ADMIN_TOKEN 时提供管理接口
+	var admin *adminAPI
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		admin = newAdminAPI(token, controller)
+	}
+	go serveHTTP(ctx, newHTTPServer(httpAddr, controller, admin))
+
 	// 运行控制器
 	log.Info("Starting pod controller...")
 	err = controller.Run(ctx)
@@ -185,3 +185,40 @@ func BenchmarkIntersection(b *testing.B) {
 		_ = intersection(a, sliceB)
 	}
 }
+
+func TestSucceededBackends(t *testing.T) {
+	backends := []Backend{{IP: "10.0.0.1", Port: 80}, {IP: "10.0.0.2", Port: 80}}
+
+	tests := []struct {
+		name string
+		err  error
+		want []Backend
+	}{
+		{
+			name: "no error",
+			err:  nil,
+			want: backends,
+		},
+		{
+			name: "partial failure",
+			err: &BatchError{Failed: []FailedTarget{
+				{EniIP: "10.0.0.1", Port: 80},
+			}},
+			want: []Backend{{IP: "10.0.0.2", Port: 80}},
+		},
+		{
+			name: "unknown error",
+			err:  &TaskFailedError{RequestID: "req-1"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := succeededBackends(backends, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("succeededBackends() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
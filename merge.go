@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleConflict 是与其他文件中的配置冲突而被忽略的配置
+type RuleConflict struct {
+	LoadBalancerID string `json:"load_balancer_id"`
+	Protocol       string `json:"protocol,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	Domain         string `json:"domain,omitempty"`
+	URL            string `json:"url,omitempty"`
+	File           string `json:"file"`
+	ExistingFile   string `json:"existing_file"`
+	Reason         string `json:"reason"`
+}
+
+func (c RuleConflict) String() string {
+	if c.Protocol == "" {
+		return fmt.Sprintf("%s in %s conflicts with %s: %s", c.LoadBalancerID, c.File, c.ExistingFile, c.Reason)
+	}
+	return fmt.Sprintf("%s %s:%d %s%s in %s conflicts with %s: %s",
+		c.LoadBalancerID, strings.ToUpper(c.Protocol), c.Port, c.Domain, c.URL, c.File, c.ExistingFile, c.Reason)
+}
+
+// rulesFile 是一个规则文件解析后的规则
+type rulesFile struct {
+	name  string
+	rules []RuleConfig
+}
+
+// lbCandidate 是某个文件中负载均衡器的区域和凭证配置
+type lbCandidate struct {
+	file    string
+	region  string
+	profile string
+}
+
+// ruleCandidate 是某个文件中一个转发规则的配置
+type ruleCandidate struct {
+	file           string
+	loadBalancerID string
+	protocol       string
+	port           int
+	rule           ListenerRuleConfig
+}
+
+// lbFile 标识某个文件中某个负载均衡器的配置
+type lbFile struct {
+	loadBalancerID string
+	file           string
+}
+
+// 冲突的配置都没有生效过时附加在冲突原因后的说明
+const conflictDroppedReason = "; none of them was applied before, all are ignored"
+
+// ruleOwners 记录每个负载均衡器和转发规则当前生效的配置来自哪个文件，
+// 文件之间出现冲突时保留已生效的配置，新增的文件（即使配置相同）不会接管已有的归属
+type ruleOwners struct {
+	// 负载均衡器 ID 到提供其区域和凭证配置的文件
+	LoadBalancers map[string]string `json:"load_balancers"`
+	// 转发规则（见 bindingKey）到提供其后端配置的文件
+	Bindings map[string]string `json:"bindings"`
+}
+
+func newRuleOwners() *ruleOwners {
+	return &ruleOwners{LoadBalancers: make(map[string]string), Bindings: make(map[string]string)}
+}
+
+// mergeRules 按文件顺序合并规则，并返回合并后的归属。同一负载均衡器、监听器和域名/URL 在多个文件中的配置相同时只保留一份；
+// 后端不同时保留 previous 中记录的归属文件的版本，其余作为冲突返回；
+// 归属文件中已没有这项配置（或这项配置此前没有生效过）时，所有不同的版本都被忽略并作为冲突返回。
+// 归属不由文件名决定，新增的文件不会接管已有的绑定。
+// previous 为 nil 表示没有归属记录（首次启动或记录无法读取），此时保留文件顺序靠前的版本，而不是忽略正在生效的配置。
+// 同一负载均衡器在不同文件中的区域或凭证配置不一致时，按相同的方式处理各文件中该负载均衡器的全部配置
+func mergeRules(files []rulesFile, previous *ruleOwners) ([]RuleConfig, []RuleConflict, *ruleOwners) {
+	known := previous != nil
+	if previous == nil {
+		previous = newRuleOwners()
+	}
+	owners := newRuleOwners()
+	var conflicts []RuleConflict
+
+	// 区域和凭证配置冲突时，被忽略的文件中该负载均衡器的配置全部跳过
+	lbCandidates := make(map[string][]lbCandidate)
+	var lbOrder []string
+	for _, file := range files {
+		for _, rule := range file.rules {
+			if _, ok := lbCandidates[rule.LoadBalancerID]; !ok {
+				lbOrder = append(lbOrder, rule.LoadBalancerID)
+			}
+			lbCandidates[rule.LoadBalancerID] = append(lbCandidates[rule.LoadBalancerID],
+				lbCandidate{file: file.name, region: rule.Region, profile: rule.CredentialProfile})
+		}
+	}
+	rejected := make(map[lbFile]bool)
+	for _, id := range lbOrder {
+		candidates := lbCandidates[id]
+		names := make([]string, len(candidates))
+		for i, c := range candidates {
+			names[i] = c.file
+		}
+		same := func(i, j int) bool {
+			return candidates[i].region == candidates[j].region && candidates[i].profile == candidates[j].profile
+		}
+		winner := resolveConflict(names, same, previous.LoadBalancers[id], known)
+		if winner >= 0 {
+			owners.LoadBalancers[id] = names[winner]
+		}
+		for i, c := range candidates {
+			if winner >= 0 && same(i, winner) {
+				continue
+			}
+			rejected[lbFile{id, c.file}] = true
+			reason := "region or credential_profile differs"
+			if winner < 0 {
+				reason += conflictDroppedReason
+			}
+			conflicts = append(conflicts, RuleConflict{
+				LoadBalancerID: id,
+				File:           c.file,
+				ExistingFile:   names[conflictingWith(i, winner, len(candidates), same)],
+				Reason:         reason,
+			})
+		}
+	}
+
+	// 按转发规则收集各文件中的后端配置，并选出保留的版本
+	ruleCandidates := make(map[string][]ruleCandidate)
+	var ruleOrder []string
+	forEachRule(files, rejected, func(key string, c ruleCandidate) {
+		if _, ok := ruleCandidates[key]; !ok {
+			ruleOrder = append(ruleOrder, key)
+		}
+		ruleCandidates[key] = append(ruleCandidates[key], c)
+	})
+	winners := make(map[string]int, len(ruleOrder))
+	for _, key := range ruleOrder {
+		candidates := ruleCandidates[key]
+		names := make([]string, len(candidates))
+		for i, c := range candidates {
+			names[i] = c.file
+		}
+		same := func(i, j int) bool { return sameRuleBackends(candidates[i].rule, candidates[j].rule) }
+		winner := resolveConflict(names, same, previous.Bindings[key], known)
+		winners[key] = winner
+		if winner >= 0 {
+			owners.Bindings[key] = names[winner]
+		}
+		for i, c := range candidates {
+			if winner >= 0 && same(i, winner) {
+				continue
+			}
+			other := candidates[conflictingWith(i, winner, len(candidates), same)]
+			reason := fmt.Sprintf("backend %s differs from %s", formatRuleBackends(c.rule), formatRuleBackends(other.rule))
+			if winner < 0 {
+				reason += conflictDroppedReason
+			}
+			conflicts = append(conflicts, RuleConflict{
+				LoadBalancerID: c.loadBalancerID,
+				Protocol:       c.protocol,
+				Port:           c.port,
+				Domain:         c.rule.Domain,
+				URL:            c.rule.URL,
+				File:           c.file,
+				ExistingFile:   other.file,
+				Reason:         reason,
+			})
+		}
+	}
+
+	// 按文件顺序输出保留的版本
+	var merged []RuleConfig
+	occurrences := make(map[string]int)
+	for _, file := range files {
+		for _, rule := range file.rules {
+			if rejected[lbFile{rule.LoadBalancerID, file.name}] {
+				continue
+			}
+			out := RuleConfig{
+				LoadBalancerID:    rule.LoadBalancerID,
+				Region:            rule.Region,
+				CredentialProfile: rule.CredentialProfile,
+				file:              file.name,
+			}
+			for _, listener := range rule.Listeners {
+				outListener := ListenerConfig{Port: listener.Port, Protocol: listener.Protocol}
+				for _, listenerRule := range listener.Rules {
+					key := bindingKey(rule.LoadBalancerID, listener, listenerRule)
+					index := occurrences[key]
+					occurrences[key]++
+					if index == winners[key] {
+						outListener.Rules = append(outListener.Rules, listenerRule)
+					}
+				}
+				if len(outListener.Rules) > 0 {
+					out.Listeners = append(out.Listeners, outListener)
+				}
+			}
+			merged = append(merged, out)
+		}
+	}
+	return merged, conflicts, owners
+}
+
+// forEachRule 按文件顺序遍历未被忽略的负载均衡器配置中的转发规则
+func forEachRule(files []rulesFile, rejected map[lbFile]bool, fn func(key string, c ruleCandidate)) {
+	for _, file := range files {
+		for _, rule := range file.rules {
+			if rejected[lbFile{rule.LoadBalancerID, file.name}] {
+				continue
+			}
+			for _, listener := range rule.Listeners {
+				for _, listenerRule := range listener.Rules {
+					fn(bindingKey(rule.LoadBalancerID, listener, listenerRule), ruleCandidate{
+						file:           file.name,
+						loadBalancerID: rule.LoadBalancerID,
+						protocol:       listener.Protocol,
+						port:           listener.Port,
+						rule:           listenerRule,
+					})
+				}
+			}
+		}
+	}
+}
+
+func bindingKey(loadBalancerID string, listener ListenerConfig, rule ListenerRuleConfig) string {
+	return fmt.Sprintf("%s/%s:%d/%s%s", loadBalancerID, strings.ToLower(listener.Protocol), listener.Port, rule.Domain, rule.URL)
+}
+
+// resolveConflict 在同一配置的多个版本中选出保留的版本，返回其下标。previous 为记录的归属文件，
+// 存在时总是保留它的版本（所有版本相同时也是如此，以免归属转移到其他文件）；
+// 不存在时所有版本相同或没有归属记录（known 为 false）则保留第一个，否则返回 -1
+func resolveConflict(files []string, same func(i, j int) bool, previous string, known bool) int {
+	for i, file := range files {
+		if previous != "" && file == previous {
+			return i
+		}
+	}
+	if !known {
+		return 0
+	}
+	for i := 1; i < len(files); i++ {
+		if !same(0, i) {
+			return -1
+		}
+	}
+	return 0
+}
+
+// conflictingWith 返回与第 i 个版本冲突的版本：有保留的版本时为保留的版本，否则为第一个不同的版本
+func conflictingWith(i, winner, n int, same func(i, j int) bool) int {
+	if winner >= 0 {
+		return winner
+	}
+	for j := 0; j < n; j++ {
+		if !same(i, j) {
+			return j
+		}
+	}
+	return i
+}
+
+func formatBackend(backend BackendConfig) string {
+	s := fmt.Sprintf("%s/%s:%d", backend.Namespace, backend.Deployment, backend.Port)
+	if backend.Weight != nil {
+		s += fmt.Sprintf(" weight %d", *backend.Weight)
+	}
+	if backend.SlowStart > 0 {
+		s += fmt.Sprintf(" slow start %s", backend.SlowStart)
+	}
+	if backend.Safety != (SafetyConfig{}) {
+		s += fmt.Sprintf(" safety %+v", backend.Safety)
+	}
+	return s
+}
+
+// formatRuleBackends 返回转发规则的后端，按比例分配流量时列出每个后端及其比例
+func formatRuleBackends(rule ListenerRuleConfig) string {
+	if len(rule.Backends) == 0 {
+		return formatBackend(rule.Backend)
+	}
+	var parts []string
+	for _, backend := range rule.Backends {
+		parts = append(parts, fmt.Sprintf("%s %d%%", formatBackend(backend.BackendConfig), backend.Share))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sameRuleBackends(a, b ListenerRuleConfig) bool {
+	if !sameBackend(a.Backend, b.Backend) || len(a.Backends) != len(b.Backends) {
+		return false
+	}
+	for i := range a.Backends {
+		if !sameBackend(a.Backends[i].BackendConfig, b.Backends[i].BackendConfig) || a.Backends[i].Share != b.Backends[i].Share {
+			return false
+		}
+	}
+	return true
+}
+
+func sameBackend(a, b BackendConfig) bool {
+	return a.Namespace == b.Namespace && a.Deployment == b.Deployment && a.Port == b.Port &&
+		sameWeight(a.Weight, b.Weight) && a.SlowStart == b.SlowStart && a.Safety == b.Safety
+}
+
+// sameWeight 比较两个可选的权重，均未设置时视为相同
+func sameWeight(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// loadBalancerIDs 返回规则中不重复的负载均衡器
+func loadBalancerIDs(rules []RuleConfig) []string {
+	var ids []string
+	seen := make(map[string]struct{})
+	for _, rule := range rules {
+		if _, ok := seen[rule.LoadBalancerID]; ok {
+			continue
+		}
+		seen[rule.LoadBalancerID] = struct{}{}
+		ids = append(ids, rule.LoadBalancerID)
+	}
+	return ids
+}
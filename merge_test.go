@@ -0,0 +1,228 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParseRules(t *testing.T, data string) []RuleConfig {
+	t.Helper()
+	rules, err := parseRules([]byte(data))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+	return rules
+}
+
+func rulesFor(lb, region, domain, deployment string) string {
+	return `- load_balancer_id: ` + lb + `
+  region: ` + region + `
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: ` + domain + `
+          url: /
+          backend:
+            namespace: default
+            deployment: ` + deployment + `
+            port: 8080
+`
+}
+
+func TestMergeRules(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		order         []string
+		previous      map[string]string
+		coldStart     bool
+		wantBindings  []string
+		wantConflicts []string
+	}{
+		{
+			name: "different bindings on the same load balancer",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "b.example.com", "app-b"),
+			},
+			order:        []string{"a.yaml", "b.yaml"},
+			wantBindings: []string{"a.yaml:a.example.com:app-a", "b.yaml:b.example.com:app-b"},
+		},
+		{
+			name: "identical duplicate is ignored",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+			},
+			order:        []string{"a.yaml", "b.yaml"},
+			wantBindings: []string{"a.yaml:a.example.com:app-a"},
+		},
+		{
+			name: "conflicting backend without a previous owner is ignored",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"),
+			},
+			order: []string{"a.yaml", "b.yaml"},
+			wantConflicts: []string{
+				"lb-00000001 HTTP:80 a.example.com/ in a.yaml conflicts with b.yaml: backend default/app-a:8080 differs from default/app-b:8080" + conflictDroppedReason,
+				"lb-00000001 HTTP:80 a.example.com/ in b.yaml conflicts with a.yaml: backend default/app-b:8080 differs from default/app-a:8080" + conflictDroppedReason,
+			},
+		},
+		{
+			name: "conflicting backend without owner records keeps the first file",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"),
+			},
+			order:         []string{"a.yaml", "b.yaml"},
+			coldStart:     true,
+			wantBindings:  []string{"a.yaml:a.example.com:app-a"},
+			wantConflicts: []string{"lb-00000001 HTTP:80 a.example.com/ in b.yaml conflicts with a.yaml: backend default/app-b:8080 differs from default/app-a:8080"},
+		},
+		{
+			name: "conflicting backend keeps the previous owner",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"),
+			},
+			order:         []string{"a.yaml", "b.yaml"},
+			previous:      map[string]string{"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b")},
+			wantBindings:  []string{"b.yaml:a.example.com:app-b"},
+			wantConflicts: []string{"lb-00000001 HTTP:80 a.example.com/ in a.yaml conflicts with b.yaml: backend default/app-a:8080 differs from default/app-b:8080"},
+		},
+		{
+			name: "previous owner keeps its binding after changing the backend",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-c"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"),
+			},
+			order:         []string{"a.yaml", "b.yaml"},
+			previous:      map[string]string{"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a")},
+			wantBindings:  []string{"a.yaml:a.example.com:app-c"},
+			wantConflicts: []string{"lb-00000001 HTTP:80 a.example.com/ in b.yaml conflicts with a.yaml: backend default/app-b:8080 differs from default/app-c:8080"},
+		},
+		{
+			name: "different weight is a conflict",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": strings.Replace(rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+					"port: 8080\n", "port: 8080\n            weight: 50\n", 1),
+			},
+			order:         []string{"a.yaml", "b.yaml"},
+			previous:      map[string]string{"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a")},
+			wantBindings:  []string{"a.yaml:a.example.com:app-a"},
+			wantConflicts: []string{"lb-00000001 HTTP:80 a.example.com/ in b.yaml conflicts with a.yaml: backend default/app-a:8080 weight 50 differs from default/app-a:8080"},
+		},
+		{
+			name: "conflicting region keeps the previous owner",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-shanghai", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-beijing", "b.example.com", "app-b"),
+			},
+			order:         []string{"a.yaml", "b.yaml"},
+			previous:      map[string]string{"b.yaml": rulesFor("lb-00000001", "ap-beijing", "b.example.com", "app-b")},
+			wantBindings:  []string{"b.yaml:b.example.com:app-b"},
+			wantConflicts: []string{"lb-00000001 in a.yaml conflicts with b.yaml: region or credential_profile differs"},
+		},
+		{
+			name: "conflicting region without a previous owner drops the load balancer",
+			files: map[string]string{
+				"a.yaml": rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"),
+				"b.yaml": rulesFor("lb-00000001", "ap-shanghai", "b.example.com", "app-b"),
+			},
+			order: []string{"a.yaml", "b.yaml"},
+			wantConflicts: []string{
+				"lb-00000001 in a.yaml conflicts with b.yaml: region or credential_profile differs" + conflictDroppedReason,
+				"lb-00000001 in b.yaml conflicts with a.yaml: region or credential_profile differs" + conflictDroppedReason,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []rulesFile
+			for _, name := range tt.order {
+				files = append(files, rulesFile{name: name, rules: mustParseRules(t, tt.files[name])})
+			}
+
+			// 由上一次生效的文件得到归属
+			var previousFiles []rulesFile
+			for name, data := range tt.previous {
+				previousFiles = append(previousFiles, rulesFile{name: name, rules: mustParseRules(t, data)})
+			}
+			_, _, previous := mergeRules(previousFiles, nil)
+			if tt.coldStart {
+				previous = nil
+			}
+
+			merged, conflicts, _ := mergeRules(files, previous)
+
+			if bindings := bindingsOf(merged); !reflect.DeepEqual(bindings, tt.wantBindings) {
+				t.Errorf("mergeRules() bindings = %v, want %v", bindings, tt.wantBindings)
+			}
+
+			var got []string
+			for _, conflict := range conflicts {
+				got = append(got, conflict.String())
+			}
+			if !reflect.DeepEqual(got, tt.wantConflicts) {
+				t.Errorf("mergeRules() conflicts = %v, want %v", got, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func bindingsOf(rules []RuleConfig) []string {
+	var bindings []string
+	for _, rule := range rules {
+		for _, listener := range rule.Listeners {
+			for _, r := range listener.Rules {
+				bindings = append(bindings, rule.file+":"+r.Domain+":"+r.Backend.Deployment)
+			}
+		}
+	}
+	return bindings
+}
+
+func TestMergeRulesIdenticalCopyDoesNotTakeOwnership(t *testing.T) {
+	original := mustParseRules(t, rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"))
+	edited := mustParseRules(t, rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-c"))
+
+	// b.yaml 提供绑定
+	_, _, owners := mergeRules([]rulesFile{{name: "b.yaml", rules: original}}, nil)
+
+	// a.yaml 新增完全相同的配置，归属仍然是 b.yaml
+	merged, conflicts, owners := mergeRules([]rulesFile{
+		{name: "a.yaml", rules: original},
+		{name: "b.yaml", rules: original},
+	}, owners)
+	if got, want := bindingsOf(merged), []string{"b.yaml:a.example.com:app-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bindings after identical copy = %v, want %v", got, want)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts after identical copy = %v, want none", conflicts)
+	}
+	if got := owners.LoadBalancers["lb-00000001"]; got != "b.yaml" {
+		t.Errorf("load balancer owner = %q, want b.yaml", got)
+	}
+
+	// b.yaml 修改后端，修改生效，a.yaml 中的旧副本作为冲突忽略
+	merged, conflicts, _ = mergeRules([]rulesFile{
+		{name: "a.yaml", rules: original},
+		{name: "b.yaml", rules: edited},
+	}, owners)
+	if got, want := bindingsOf(merged), []string{"b.yaml:a.example.com:app-c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bindings after edit = %v, want %v", got, want)
+	}
+	wantConflicts := []string{"lb-00000001 HTTP:80 a.example.com/ in a.yaml conflicts with b.yaml: backend default/app-b:8080 differs from default/app-c:8080"}
+	var got []string
+	for _, conflict := range conflicts {
+		got = append(got, conflict.String())
+	}
+	if !reflect.DeepEqual(got, wantConflicts) {
+		t.Errorf("conflicts after edit = %v, want %v", got, wantConflicts)
+	}
+}
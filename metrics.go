@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clbRateLimitWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sync_pod_to_clb_rate_limit_wait_seconds",
+		Help:    "Time spent waiting for the client-side rate limiter before calling a CLB API.",
+		Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"action"})
+
+	rulesInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_rules_info",
+		Help: "Source and version of the rules currently applied, always 1.",
+	}, []string{"source", "version"})
+
+	rulesLastReloadTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_rules_last_reload_timestamp_seconds",
+		Help: "Unix time of the last successful rules load.",
+	})
+
+	unresolvedRules = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_unresolved_rules",
+		Help: "Configured rules that do not match any listener or rule on the load balancer.",
+	}, []string{"load_balancer_id"})
+
+	ruleConflicts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_rule_conflicts",
+		Help: "Rules ignored because they conflict with rules in another file.",
+	})
+
+	invalidRulesFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_invalid_rules_files",
+		Help: "Rules files that failed to parse or validate on the last load.",
+	})
+
+	clbStateRefreshErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_pod_to_clb_state_refresh_errors_total",
+		Help: "Failed attempts to refresh the observed state of a load balancer.",
+	}, []string{"load_balancer_id"})
+
+	clbStateLastRefreshTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_state_last_refresh_timestamp_seconds",
+		Help: "Unix time of the last successful state refresh of a load balancer.",
+	}, []string{"load_balancer_id"})
+
+	deregistrationBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_pod_to_clb_deregistration_blocked_total",
+		Help: "Deregistrations blocked by the minimum-backend safety limits.",
+	}, []string{"load_balancer_id"})
+
+	deregistrationsQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_deregistrations_queued",
+		Help: "Backends waiting to be deregistered until the deregistration budget refills.",
+	}, []string{"load_balancer_id"})
+
+	globalFreeze = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_pod_to_clb_frozen",
+		Help: "Whether the global freeze switch is on (1) or off (0).",
+	})
+
+	frozenSkippedChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_pod_to_clb_frozen_skipped_changes_total",
+		Help: "Backend changes computed but skipped because mutations were frozen, counted on every sync.",
+	}, []string{"load_balancer_id", "action"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		clbRateLimitWaitSeconds,
+		rulesInfo,
+		rulesLastReloadTimestamp,
+		unresolvedRules,
+		ruleConflicts,
+		invalidRulesFiles,
+		clbStateRefreshErrors,
+		clbStateLastRefreshTimestamp,
+		deregistrationBlocked,
+		deregistrationsQueued,
+		globalFreeze,
+		frozenSkippedChanges,
+	)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// v1 字段名与 v2 不同的字段
+var v2FieldNames = map[string]string{
+	"load_balancer_id":    "id",
+	"credential_profile":  "credentialProfile",
+	"slow_start":          "slowStart",
+	"min_backends":        "minBackends",
+	"min_percent":         "minPercent",
+	"max_removal_percent": "maxRemovalPercent",
+}
+
+// 可以提取为默认值的后端字段
+var defaultBackendFields = []string{"namespace", "port"}
+
+// backendDefaults 是各级默认值中的后端字段及其原始节点
+type backendDefaults map[string]*yaml.Node
+
+// migrateRulesV1 将未替换变量的 v1 规则节点转换为 v2 格式的节点，并把所有转发规则共有的后端命名空间和端口提取为默认值：
+// 先提取为文件级默认值，再依次提取为负载均衡器级和监听器级默认值。字段值按原始文本复制和比较，
+// 变量引用在转换后保持原样。Deployment、权重、慢启动时长和安全限制总是保留在转发规则中
+func migrateRulesV1(doc *yaml.Node) *yaml.Node {
+	lbs := sequenceItems(doc)
+	var backends []*yaml.Node
+	for _, lb := range lbs {
+		backends = append(backends, backendNodesOf(lb)...)
+	}
+	global := commonBackend(backends, nil)
+
+	out := mappingNode()
+	setField(out, "apiVersion", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: rulesAPIVersionV2})
+	setDefaults(out, global)
+	loadBalancers := sequenceNode()
+	for _, lb := range lbs {
+		outLB := mappingNode()
+		copyFields(outLB, lb, "load_balancer_id", "region", "credential_profile")
+		lbDefaults := commonBackend(backendNodesOf(lb), global)
+		setDefaults(outLB, lbDefaults)
+		lbInherited := overlayBackend(global, lbDefaults)
+
+		listeners := sequenceNode()
+		for _, listener := range sequenceItems(fieldNode(lb, "listeners")) {
+			outListener := mappingNode()
+			copyFields(outListener, listener, "protocol", "port")
+			defaults := commonBackend(backendNodesOf(listener), lbInherited)
+			setDefaults(outListener, defaults)
+			inherited := overlayBackend(lbInherited, defaults)
+
+			rules := sequenceNode()
+			for _, rule := range sequenceItems(fieldNode(listener, "rules")) {
+				outRule := mappingNode()
+				copyFields(outRule, rule, "domain", "url")
+				if backend := fieldNode(rule, "backend"); backend != nil {
+					setField(outRule, "backend", diffBackend(backend, inherited))
+				}
+				if split := fieldNode(rule, "backends"); split != nil {
+					members := sequenceNode()
+					for _, member := range sequenceItems(split) {
+						outMember := diffBackend(member, inherited)
+						copyFields(outMember, member, "share")
+						members.Content = append(members.Content, outMember)
+					}
+					setField(outRule, "backends", members)
+				}
+				rules.Content = append(rules.Content, outRule)
+			}
+			setField(outListener, "rules", rules)
+			listeners.Content = append(listeners.Content, outListener)
+		}
+		setField(outLB, "listeners", listeners)
+		loadBalancers.Content = append(loadBalancers.Content, outLB)
+	}
+	setField(out, "loadBalancers", loadBalancers)
+	return out
+}
+
+// backendNodesOf 返回负载均衡器、监听器或转发规则节点下所有后端的节点
+func backendNodesOf(node *yaml.Node) []*yaml.Node {
+	var backends []*yaml.Node
+	for _, listener := range sequenceItems(fieldNode(node, "listeners")) {
+		backends = append(backends, backendNodesOf(listener)...)
+	}
+	for _, rule := range sequenceItems(fieldNode(node, "rules")) {
+		backends = append(backends, backendNodesOf(rule)...)
+	}
+	if backend := fieldNode(node, "backend"); backend != nil {
+		backends = append(backends, backend)
+	}
+	return append(backends, sequenceItems(fieldNode(node, "backends"))...)
+}
+
+// commonBackend 返回所有后端中原始文本相同、且与已继承的值不同的命名空间和端口
+func commonBackend(backends []*yaml.Node, inherited backendDefaults) backendDefaults {
+	common := make(backendDefaults)
+	if len(backends) == 0 {
+		return common
+	}
+	for _, key := range defaultBackendFields {
+		value := fieldNode(backends[0], key)
+		for _, backend := range backends[1:] {
+			if !sameScalar(fieldNode(backend, key), value) {
+				value = nil
+				break
+			}
+		}
+		if value != nil && !sameScalar(value, inherited[key]) {
+			common[key] = value
+		}
+	}
+	return common
+}
+
+// overlayBackend 用 override 中设置的字段覆盖 base
+func overlayBackend(base, override backendDefaults) backendDefaults {
+	merged := make(backendDefaults, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// diffBackend 返回后端中与继承值不同的字段
+func diffBackend(backend *yaml.Node, inherited backendDefaults) *yaml.Node {
+	out := mappingNode()
+	for _, key := range []string{"namespace", "deployment", "port", "weight", "slow_start"} {
+		if value := fieldNode(backend, key); value != nil && !sameScalar(value, inherited[key]) {
+			setField(out, v2FieldName(key), value)
+		}
+	}
+	if safety := fieldNode(backend, "safety"); safety != nil {
+		outSafety := mappingNode()
+		copyFields(outSafety, safety, "min_backends", "min_percent", "max_removal_percent")
+		setField(out, "safety", outSafety)
+	}
+	return out
+}
+
+// setDefaults 在 defaults.backend 中按固定顺序写入默认值，没有默认值时不写入
+func setDefaults(node *yaml.Node, defaults backendDefaults) {
+	if len(defaults) == 0 {
+		return
+	}
+	backend := mappingNode()
+	for _, key := range defaultBackendFields {
+		if value, ok := defaults[key]; ok {
+			setField(backend, key, value)
+		}
+	}
+	outDefaults := mappingNode()
+	setField(outDefaults, "backend", backend)
+	setField(node, "defaults", outDefaults)
+}
+
+// copyFields 按给定顺序复制存在的字段，并转换为 v2 字段名
+func copyFields(out, in *yaml.Node, keys ...string) {
+	for _, key := range keys {
+		if value := fieldNode(in, key); value != nil {
+			setField(out, v2FieldName(key), value)
+		}
+	}
+}
+
+func v2FieldName(key string) string {
+	if name, ok := v2FieldNames[key]; ok {
+		return name
+	}
+	return key
+}
+
+func setField(node *yaml.Node, key string, value *yaml.Node) {
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func sameScalar(a, b *yaml.Node) bool {
+	return a != nil && b != nil && a.Kind == yaml.ScalarNode && b.Kind == yaml.ScalarNode && a.Value == b.Value
+}
+
+func mappingNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func sequenceNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+}
+
+// migrateRules 将 v1 格式的规则文件转换为 v2 格式。转换基于未替换变量的原文，变量引用和 $$ 原样保留；
+// 转换后按当前的变量值展开，确认与原规则一致
+func migrateRules(data []byte) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(err)
+	}
+	doc := documentContent(&root)
+	if doc != nil && doc.Kind == yaml.MappingNode {
+		return nil, fmt.Errorf("rules are not in v1 format")
+	}
+
+	rules, err := parseRules(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(migrateRulesV1(doc)); err != nil {
+		return nil, err
+	}
+	encoder.Close()
+
+	migrated, err := parseRules(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("migrated rules are invalid: %v", err)
+	}
+	if !reflect.DeepEqual(migrated, rules) {
+		return nil, fmt.Errorf("migrated rules do not match the original rules")
+	}
+	return buf.Bytes(), nil
+}
+
+// runMigrateConfig 实现 migrate-config 子命令：将 v1 规则文件转换为 v2 格式
+func runMigrateConfig(args []string) int {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	output := fs.String("o", "", "write the migrated rules to this file instead of stdout")
+	fs.StringVar(&clusterName, "cluster-name", envString(clusterNameVariable, ""), "cluster name used to check the migrated rules, see -cluster-name of the controller (env CLUSTER_NAME)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s migrate-config [-o output] [-cluster-name name] [file]\n\nConvert a v1 rules file to the v2 format, defaults to RULES_FILE or %s.\n", os.Args[0], defaultRulesPath)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path := envString("RULES_FILE", defaultRulesPath)
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	migrated, err := migrateRules(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	if *output == "" {
+		os.Stdout.Write(migrated)
+		return 0
+	}
+	if err := os.WriteFile(*output, migrated, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *output, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrateRules(t *testing.T) {
+	v1 := `- load_balancer_id: lb-aaaaaaaa
+  listeners:
+    - port: 443
+      protocol: https
+      rules:
+        - domain: a.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: web
+            port: 8080
+        - domain: a.example.com
+          url: /api
+          backend:
+            namespace: default
+            deployment: api
+            port: 8080
+- load_balancer_id: lb-bbbbbbbb
+  region: ap-guangzhou
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: b.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: web
+            port: 9090
+`
+	want := `apiVersion: v2
+defaults:
+  backend:
+    namespace: default
+loadBalancers:
+  - id: lb-aaaaaaaa
+    defaults:
+      backend:
+        port: 8080
+    listeners:
+      - protocol: https
+        port: 443
+        rules:
+          - domain: a.example.com
+            url: /
+            backend:
+              deployment: web
+          - domain: a.example.com
+            url: /api
+            backend:
+              deployment: api
+  - id: lb-bbbbbbbb
+    region: ap-guangzhou
+    defaults:
+      backend:
+        port: 9090
+    listeners:
+      - protocol: http
+        port: 80
+        rules:
+          - domain: b.example.com
+            url: /
+            backend:
+              deployment: web
+`
+
+	got, err := migrateRules([]byte(v1))
+	if err != nil {
+		t.Fatalf("migrateRules() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("migrateRules() =\n%s\nwant\n%s", got, want)
+	}
+
+	original, _ := parseRules([]byte(v1))
+	migrated, err := parseRules(got)
+	if err != nil {
+		t.Fatalf("parseRules(migrated) error = %v", err)
+	}
+	if !reflect.DeepEqual(migrated, original) {
+		t.Errorf("migrated rules = %+v, want %+v", migrated, original)
+	}
+}
+
+func TestMigrateRulesRejectsV2(t *testing.T) {
+	_, err := migrateRules([]byte(v2Rules))
+	if err == nil || !strings.Contains(err.Error(), "not in v1 format") {
+		t.Errorf("migrateRules() error = %v, want not in v1 format", err)
+	}
+}
+
+func TestMigrateRulesSplit(t *testing.T) {
+	got, err := migrateRules([]byte(splitRules))
+	if err != nil {
+		t.Fatalf("migrateRules() error = %v", err)
+	}
+	if !strings.Contains(string(got), "backends:") {
+		t.Errorf("migrateRules() =\n%s\nwant backends", got)
+	}
+
+	original, _ := parseRules([]byte(splitRules))
+	migrated, err := parseRules(got)
+	if err != nil {
+		t.Fatalf("parseRules(migrated) error = %v", err)
+	}
+	if !reflect.DeepEqual(migrated, original) {
+		t.Errorf("migrated rules = %+v, want %+v", migrated, original)
+	}
+}
+
+func TestMigrateRulesKeepsVariables(t *testing.T) {
+	t.Setenv("RULES_VAR_APP_PORT", "")
+	clusterName = "staging"
+	defer func() { clusterName = "" }()
+
+	v1 := `- load_balancer_id: lb-aaaaaaaa
+  listeners:
+    - port: 443
+      protocol: https
+      rules:
+        - domain: ${CLUSTER_NAME}.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: web
+            port: ${RULES_VAR_APP_PORT:-8080}
+        - domain: ${CLUSTER_NAME}.example.com
+          url: /$$api
+          backend:
+            namespace: default
+            deployment: api
+            port: ${RULES_VAR_APP_PORT:-8080}
+- load_balancer_id: lb-bbbbbbbb
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: b.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: web
+            port: 8080
+`
+	// 端口的原始文本不同，即使当前的值相同也不提取为文件级默认值
+	want := `apiVersion: v2
+defaults:
+  backend:
+    namespace: default
+loadBalancers:
+  - id: lb-aaaaaaaa
+    defaults:
+      backend:
+        port: ${RULES_VAR_APP_PORT:-8080}
+    listeners:
+      - protocol: https
+        port: 443
+        rules:
+          - domain: ${CLUSTER_NAME}.example.com
+            url: /
+            backend:
+              deployment: web
+          - domain: ${CLUSTER_NAME}.example.com
+            url: /$$api
+            backend:
+              deployment: api
+  - id: lb-bbbbbbbb
+    defaults:
+      backend:
+        port: 8080
+    listeners:
+      - protocol: http
+        port: 80
+        rules:
+          - domain: b.example.com
+            url: /
+            backend:
+              deployment: web
+`
+
+	got, err := migrateRules([]byte(v1))
+	if err != nil {
+		t.Fatalf("migrateRules() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("migrateRules() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// 状态 ConfigMap 中保存规则归属的 key，值为 JSON
+const ruleOwnersKey = "rule-owners"
+
+// ruleOwnersStore 将规则的归属保存在状态 ConfigMap 中，控制器重启后仍按原来的归属解决文件之间的冲突
+type ruleOwnersStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func newRuleOwnersStore(clientset kubernetes.Interface, namespace, name string) *ruleOwnersStore {
+	return &ruleOwnersStore{clientset: clientset, namespace: namespace, name: name}
+}
+
+// load 读取保存的归属，ConfigMap 或 key 不存在时返回 nil
+func (s *ruleOwnersStore) load() (*ruleOwners, error) {
+	data, err := readStateConfigMap(s.clientset, s.namespace, s.name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[ruleOwnersKey]
+	if !ok {
+		return nil, nil
+	}
+
+	owners := newRuleOwners()
+	if err := json.Unmarshal([]byte(value), owners); err != nil {
+		return nil, fmt.Errorf("invalid %s in state configmap %s/%s: %v", ruleOwnersKey, s.namespace, s.name, err)
+	}
+	if owners.LoadBalancers == nil {
+		owners.LoadBalancers = make(map[string]string)
+	}
+	if owners.Bindings == nil {
+		owners.Bindings = make(map[string]string)
+	}
+	return owners, nil
+}
+
+func (s *ruleOwnersStore) save(owners *ruleOwners) error {
+	data, err := json.Marshal(owners)
+	if err != nil {
+		return err
+	}
+	return writeStateConfigMap(s.clientset, s.namespace, s.name, ruleOwnersKey, string(data))
+}
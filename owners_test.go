@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRuleOwnersStore(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "state", Namespace: "ops"},
+		Data:       map[string]string{pausedBindingsKey: "default/web/lb-1/lbl-1/loc-1"},
+	})
+	store := newRuleOwnersStore(clientset, "ops", "state")
+
+	// 没有保存过归属时返回 nil，按文件顺序解决冲突
+	owners, err := store.load()
+	if err != nil || owners != nil {
+		t.Fatalf("load() = %v, %v, want nil", owners, err)
+	}
+
+	// 重启前 b.yaml 提供绑定，归属保存到 ConfigMap
+	original := mustParseRules(t, rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-b"))
+	_, _, saved := mergeRules([]rulesFile{{name: "b.yaml", rules: original}}, nil)
+	if err := store.save(saved); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	loaded, err := store.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("load() = %+v, want %+v", loaded, saved)
+	}
+	cm, err := clientset.CoreV1().ConfigMaps("ops").Get(context.Background(), "state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[pausedBindingsKey] == "" {
+		t.Error("save() should keep the other keys of the state configmap")
+	}
+
+	// 重启后 a.yaml 出现冲突的配置，仍然保留 b.yaml 的版本
+	conflicting := mustParseRules(t, rulesFor("lb-00000001", "ap-beijing", "a.example.com", "app-a"))
+	merged, _, _ := mergeRules([]rulesFile{
+		{name: "a.yaml", rules: conflicting},
+		{name: "b.yaml", rules: original},
+	}, loaded)
+	if got, want := bindingsOf(merged), []string{"b.yaml:a.example.com:app-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bindings after restart = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// 默认保存管理接口状态的 ConfigMap，位于控制器所在的 namespace
+	defaultAdminStateConfigMap = "sync-pod-to-clb-state"
+	// 状态 ConfigMap 中保存暂停的绑定的 key，每行一个绑定
+	pausedBindingsKey = "paused-bindings"
+)
+
+// BindingKey 标识一个 Deployment 到负载均衡器转发规则的绑定
+type BindingKey struct {
+	Namespace      string `json:"namespace"`
+	Deployment     string `json:"deployment"`
+	LoadBalancerID string `json:"load_balancer_id"`
+	ListenerID     string `json:"listener_id"`
+	LocationID     string `json:"location_id"`
+}
+
+func bindingKeyOf(namespace, deploymentName string, target ConfigTarget) BindingKey {
+	return BindingKey{
+		Namespace:      namespace,
+		Deployment:     deploymentName,
+		LoadBalancerID: target.LoadBalancerID,
+		ListenerID:     target.ListenerID,
+		LocationID:     target.LocationID,
+	}
+}
+
+func (k BindingKey) String() string {
+	return strings.Join([]string{k.Namespace, k.Deployment, k.LoadBalancerID, k.ListenerID, k.LocationID}, "/")
+}
+
+func parseBindingKey(value string) (BindingKey, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 5 {
+		return BindingKey{}, fmt.Errorf("invalid binding %q, expected namespace/deployment/lb/listener/location", value)
+	}
+	key := BindingKey{parts[0], parts[1], parts[2], parts[3], parts[4]}
+	if err := key.validate(); err != nil {
+		return BindingKey{}, err
+	}
+	return key, nil
+}
+
+func (k BindingKey) validate() error {
+	if k.Namespace == "" || k.Deployment == "" || k.LoadBalancerID == "" || k.ListenerID == "" || k.LocationID == "" {
+		return fmt.Errorf("binding %s must set namespace, deployment, load_balancer_id, listener_id and location_id", k)
+	}
+	return nil
+}
+
+// BindingStatus 是管理接口列出的绑定
+type BindingStatus struct {
+	BindingKey
+	Port   int  `json:"port"`
+	Paused bool `json:"paused"`
+}
+
+// pausedBindings 记录通过管理接口暂停的绑定，并保存在 ConfigMap 中以便重启后恢复
+type pausedBindings struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+
+	mu     sync.Mutex
+	paused map[BindingKey]struct{}
+}
+
+func newPausedBindings(clientset kubernetes.Interface, namespace, name string) *pausedBindings {
+	return &pausedBindings{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		paused:    make(map[BindingKey]struct{}),
+	}
+}
+
+// load 从 ConfigMap 读取暂停的绑定，ConfigMap 不存在时没有暂停的绑定，无效的行被忽略
+func (p *pausedBindings) load() error {
+	data, err := readStateConfigMap(p.clientset, p.namespace, p.name)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, line := range strings.Split(data[pausedBindingsKey], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, err := parseBindingKey(line)
+		if err != nil {
+			log.Warnf("Ignoring paused binding in configmap %s/%s: %v", p.namespace, p.name, err)
+			continue
+		}
+		p.paused[key] = struct{}{}
+	}
+	if len(p.paused) > 0 {
+		log.Warnf("Loaded %d paused bindings: %v", len(p.paused), p.listLocked())
+	}
+	return nil
+}
+
+func (p *pausedBindings) has(key BindingKey) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.paused[key]
+	return ok
+}
+
+// set 暂停或恢复绑定并保存到 ConfigMap，保存失败时不改变状态。返回状态是否发生变化
+func (p *pausedBindings) set(key BindingKey, paused bool) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.paused[key]; ok == paused {
+		return false, nil
+	}
+	if paused {
+		p.paused[key] = struct{}{}
+	} else {
+		delete(p.paused, key)
+	}
+	if err := p.saveLocked(); err != nil {
+		if paused {
+			delete(p.paused, key)
+		} else {
+			p.paused[key] = struct{}{}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *pausedBindings) listLocked() []string {
+	var lines []string
+	for key := range p.paused {
+		lines = append(lines, key.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// saveLocked 将暂停的绑定写入 ConfigMap
+func (p *pausedBindings) saveLocked() error {
+	return writeStateConfigMap(p.clientset, p.namespace, p.name, pausedBindingsKey, strings.Join(p.listLocked(), "\n"))
+}
+
+// readStateConfigMap 返回状态 ConfigMap 的内容，ConfigMap 不存在时返回 nil
+func readStateConfigMap(clientset kubernetes.Interface, namespace, name string) (map[string]string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state configmap %s/%s: %v", namespace, name, err)
+	}
+	return cm.Data, nil
+}
+
+// writeStateConfigMap 将 key 写入状态 ConfigMap，不存在时创建，保留 ConfigMap 中的其他 key
+func writeStateConfigMap(clientset kubernetes.Interface, namespace, name, key, value string) error {
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Data:       map[string]string{key: value},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = value
+		_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save state configmap %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// errUnknownBinding 表示规则中没有对应的绑定
+var errUnknownBinding = errors.New("binding not found in rules")
+
+// Bindings 返回规则中所有的绑定及其暂停状态，按绑定排序
+func (pc *PodController) Bindings() []BindingStatus {
+	var bindings []BindingStatus
+	for key, targets := range pc.config.Bindings() {
+		parts := strings.SplitN(key, "/", 2)
+		for _, target := range targets {
+			bindingKey := bindingKeyOf(parts[0], parts[1], target)
+			bindings = append(bindings, BindingStatus{
+				BindingKey: bindingKey,
+				Port:       target.Port,
+				Paused:     pc.paused.has(bindingKey),
+			})
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].String() < bindings[j].String()
+	})
+	return bindings
+}
+
+// SetPaused 暂停或恢复绑定。暂停的绑定与冻结一样只计算并报告变更，恢复后立即执行被跳过的变更
+func (pc *PodController) SetPaused(key BindingKey, paused bool) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+	if paused && !pc.hasBinding(key) {
+		return fmt.Errorf("%w: %s", errUnknownBinding, key)
+	}
+
+	changed, err := pc.paused.set(key, paused)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	if paused {
+		log.Warnf("Binding %s paused", key)
+	} else {
+		log.Warnf("Binding %s resumed", key)
+		pc.notifyThaw()
+	}
+	return nil
+}
+
+func (pc *PodController) hasBinding(key BindingKey) bool {
+	for _, target := range pc.config.GetTargets(fmt.Sprintf("%s/%s", key.Namespace, key.Deployment)) {
+		if bindingKeyOf(key.Namespace, key.Deployment, target) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Resync 立即同步 Deployment 的所有绑定
+func (pc *PodController) Resync(namespace, deploymentName string) error {
+	if len(pc.config.GetTargets(fmt.Sprintf("%s/%s", namespace, deploymentName))) == 0 {
+		return fmt.Errorf("%w: %s/%s", errUnknownBinding, namespace, deploymentName)
+	}
+	// 管理接口在控制器启动前就可以访问，冻结状态同步完成前不执行变更
+	select {
+	case <-pc.freezeSynced:
+	default:
+		return fmt.Errorf("controller is starting, freeze state is not synced yet")
+	}
+	log.Infof("Resyncing %s/%s on admin request", namespace, deploymentName)
+	return pc.syncPodToLB(namespace, deploymentName, "RESYNC", "")
+}
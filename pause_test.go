@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseBindingKey(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    BindingKey
+		wantErr bool
+	}{
+		{value: "default/web/lb-1/lbl-1/loc-1", want: BindingKey{"default", "web", "lb-1", "lbl-1", "loc-1"}},
+		{value: "default/web/lb-1/lbl-1", wantErr: true},
+		{value: "default/web/lb-1/lbl-1/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBindingKey(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBindingKey(%q) error = %v, wantErr %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseBindingKey(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPausedBindingsPersisted(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	web := BindingKey{"default", "web", "lb-1", "lbl-1", "loc-1"}
+	api := BindingKey{"default", "api", "lb-1", "lbl-1", "loc-2"}
+
+	paused := newPausedBindings(clientset, "ops", "state")
+	if err := paused.load(); err != nil {
+		t.Fatalf("load() without configmap error = %v", err)
+	}
+	for _, key := range []BindingKey{web, api} {
+		if changed, err := paused.set(key, true); err != nil || !changed {
+			t.Fatalf("set(%s, true) = %t, %v", key, changed, err)
+		}
+	}
+	if changed, err := paused.set(api, false); err != nil || !changed {
+		t.Fatalf("set(%s, false) = %t, %v", api, changed, err)
+	}
+	if changed, _ := paused.set(api, false); changed {
+		t.Errorf("set(%s, false) twice reported a change", api)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("ops").Get(context.TODO(), "state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cm.Data[pausedBindingsKey]; got != web.String() {
+		t.Errorf("configmap %s = %q, want %q", pausedBindingsKey, got, web.String())
+	}
+
+	// 重启后从 ConfigMap 恢复
+	restarted := newPausedBindings(clientset, "ops", "state")
+	if err := restarted.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.has(web) || restarted.has(api) {
+		t.Errorf("after restart has(web) = %t, has(api) = %t, want true, false", restarted.has(web), restarted.has(api))
+	}
+}
+
+func TestPausedBindingsKeepsOtherKeys(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "state", Namespace: "ops"},
+		Data:       map[string]string{"frozen": "true", pausedBindingsKey: "invalid\n"},
+	})
+	paused := newPausedBindings(clientset, "ops", "state")
+	if err := paused.load(); err != nil {
+		t.Fatal(err)
+	}
+	web := BindingKey{"default", "web", "lb-1", "lbl-1", "loc-1"}
+	if _, err := paused.set(web, true); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("ops").Get(context.TODO(), "state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["frozen"] != "true" || cm.Data[pausedBindingsKey] != web.String() {
+		t.Errorf("configmap data = %v", cm.Data)
+	}
+}
+
+func TestResyncWaitsForFreezeState(t *testing.T) {
+	pc := &PodController{
+		config: &Config{targets: map[string][]ConfigTarget{
+			"default/web": {{LoadBalancerID: "lb-abcd1234", ListenerID: "lbl-1", LocationID: "loc-1"}},
+		}},
+		freezeSynced: make(chan struct{}),
+	}
+
+	// 冻结状态同步完成前，管理接口不能触发变更
+	if err := pc.Resync("default", "web"); err == nil {
+		t.Error("Resync() before the freeze state is synced should fail")
+	}
+}
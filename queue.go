@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+)
+
+// 默认同时处理的负载均衡器数量
+const defaultMaxParallelLBs = 4
+
+type mutationKind int
+
+const (
+	mutationRegister mutationKind = iota
+	mutationDeregister
+	mutationModifyWeight
+)
+
+func (k mutationKind) String() string {
+	switch k {
+	case mutationRegister:
+		return "register"
+	case mutationModifyWeight:
+		return "modify weight"
+	}
+	return "deregister"
+}
+
+// mutation 是一次等待执行的绑定/解绑/修改权重请求
+type mutation struct {
+	kind    mutationKind
+	targets []*clb.BatchTarget
+	done    chan mutationResult
+}
+
+// mutationResult 是变更所在的合并请求的 RequestId 和属于该变更的错误
+type mutationResult struct {
+	requestIDs []string
+	err        error
+}
+
+// lbQueue 保存某个负载均衡器上待执行的变更
+type lbQueue struct {
+	pending []*mutation
+	running bool
+}
+
+// mutationQueue 按 LoadBalancerID 串行执行变更：同一负载均衡器上排队的变更会被合并为
+// 一次批量请求，不同负载均衡器之间并行执行（受 slots 的容量限制）
+type mutationQueue struct {
+	mu     sync.Mutex
+	queues map[string]*lbQueue
+	sem    chan struct{}
+	apply  func(loadBalancerID string, kind mutationKind, targets []*clb.BatchTarget) ([]string, error)
+}
+
+// newMutationQueue 创建变更队列，slots 可以在多个队列之间共享，以限制所有客户端同时变更的负载均衡器总数
+func newMutationQueue(slots chan struct{}, apply func(string, mutationKind, []*clb.BatchTarget) ([]string, error)) *mutationQueue {
+	return &mutationQueue{
+		queues: make(map[string]*lbQueue),
+		sem:    slots,
+		apply:  apply,
+	}
+}
+
+// submit 将变更加入负载均衡器的队列，阻塞直到变更执行完成，返回合并请求的 RequestId
+func (q *mutationQueue) submit(loadBalancerID string, kind mutationKind, targets []*clb.BatchTarget) ([]string, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	m := &mutation{kind: kind, targets: targets, done: make(chan mutationResult, 1)}
+
+	q.mu.Lock()
+	lq, ok := q.queues[loadBalancerID]
+	if !ok {
+		lq = &lbQueue{}
+		q.queues[loadBalancerID] = lq
+	}
+	lq.pending = append(lq.pending, m)
+	start := !lq.running
+	lq.running = true
+	q.mu.Unlock()
+
+	if start {
+		go q.drain(loadBalancerID, lq)
+	}
+	result := <-m.done
+	return result.requestIDs, result.err
+}
+
+// drain 持续处理负载均衡器队列中的变更，直到队列为空
+func (q *mutationQueue) drain(loadBalancerID string, lq *lbQueue) {
+	q.sem <- struct{}{}
+	defer func() { <-q.sem }()
+
+	for {
+		q.mu.Lock()
+		pending := lq.pending
+		lq.pending = nil
+		if len(pending) == 0 {
+			lq.running = false
+			delete(q.queues, loadBalancerID)
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		// 按提交顺序将连续的同类变更合并为一次请求
+		for start := 0; start < len(pending); {
+			end := start + 1
+			for end < len(pending) && pending[end].kind == pending[start].kind {
+				end++
+			}
+			q.applyGroup(loadBalancerID, pending[start:end])
+			start = end
+		}
+	}
+}
+
+func (q *mutationQueue) applyGroup(loadBalancerID string, group []*mutation) {
+	kind := group[0].kind
+
+	// 重复的后端只保留一个，以最后提交的权重为准
+	var merged []*clb.BatchTarget
+	seen := make(map[string]int)
+	for _, m := range group {
+		for _, target := range m.targets {
+			key := batchTargetKey(target)
+			if i, found := seen[key]; found {
+				merged[i] = target
+				continue
+			}
+			seen[key] = len(merged)
+			merged = append(merged, target)
+		}
+	}
+
+	requestIDs, err := q.apply(loadBalancerID, kind, merged)
+	for _, m := range group {
+		m.done <- mutationResult{requestIDs: requestIDs, err: errorForMutation(m, err)}
+	}
+}
+
+// errorForMutation 从合并请求的错误中挑出属于某个变更的部分
+func errorForMutation(m *mutation, err error) error {
+	var batchErr *BatchError
+	if err == nil || !errors.As(err, &batchErr) {
+		return err
+	}
+
+	own := make(map[string]struct{}, len(m.targets))
+	for _, target := range m.targets {
+		own[batchTargetKey(target)] = struct{}{}
+	}
+
+	var failed []FailedTarget
+	for _, f := range batchErr.Failed {
+		if _, found := own[failedTargetKey(f)]; found {
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BatchError{
+		Action:         batchErr.Action,
+		LoadBalancerID: batchErr.LoadBalancerID,
+		Total:          len(m.targets),
+		Failed:         failed,
+	}
+}
+
+func batchTargetKey(target *clb.BatchTarget) string {
+	return fmt.Sprintf("%s/%s/%s:%d",
+		stringValue(target.ListenerId), stringValue(target.LocationId), stringValue(target.EniIp), *target.Port)
+}
+
+func failedTargetKey(f FailedTarget) string {
+	return fmt.Sprintf("%s/%s/%s:%d", f.ListenerID, f.LocationID, f.EniIP, f.Port)
+}
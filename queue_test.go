@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+)
+
+func TestMutationQueueMergesPendingMutations(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		calls    [][]*clb.BatchTarget
+		inflight = map[string]int{}
+	)
+	release := make(chan struct{})
+
+	q := newMutationQueue(make(chan struct{}, 2), func(loadBalancerID string, kind mutationKind, targets []*clb.BatchTarget) ([]string, error) {
+		mu.Lock()
+		inflight[loadBalancerID]++
+		if inflight[loadBalancerID] > 1 {
+			t.Errorf("concurrent mutations on %s", loadBalancerID)
+		}
+		calls = append(calls, targets)
+		first := len(calls) == 1
+		requestIDs := []string{fmt.Sprintf("req-%d", len(calls))}
+		mu.Unlock()
+
+		// 第一次调用阻塞，使后续提交在队列中排队
+		if first {
+			<-release
+		}
+
+		mu.Lock()
+		inflight[loadBalancerID]--
+		mu.Unlock()
+
+		for _, target := range targets {
+			if *target.EniIp == "10.0.0.9" {
+				return requestIDs, &BatchError{Action: "BatchRegisterTargets", LoadBalancerID: loadBalancerID, Total: len(targets),
+					Failed: []FailedTarget{{ListenerID: "lbl-1", LocationID: "loc-1", EniIP: "10.0.0.9", Port: 80}}}
+			}
+		}
+		return requestIDs, nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	requestIDs := make([][]string, 3)
+	submit := func(i int, ip string) {
+		defer wg.Done()
+		requestIDs[i], errs[i] = q.submit("lb-1", mutationRegister, []*clb.BatchTarget{newBatchTarget("lbl-1", "loc-1", ip, 80)})
+	}
+
+	wg.Add(1)
+	go submit(0, "10.0.0.1")
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(calls) == 1 })
+
+	wg.Add(2)
+	go submit(1, "10.0.0.2")
+	go submit(2, "10.0.0.9")
+	waitFor(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.queues["lb-1"] != nil && len(q.queues["lb-1"].pending) == 2
+	})
+	close(release)
+	wg.Wait()
+
+	if len(calls) != 2 || len(calls[1]) != 2 {
+		t.Fatalf("expected the two queued mutations to be merged into one call, got %d calls", len(calls))
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("unexpected errors: %v, %v", errs[0], errs[1])
+	}
+	batchErr, ok := errs[2].(*BatchError)
+	if !ok || batchErr.Total != 1 || len(batchErr.Failed) != 1 {
+		t.Errorf("expected only the failing mutation to receive a BatchError, got %v", errs[2])
+	}
+	// 合并的变更共享同一次请求的 RequestId
+	if want := [][]string{{"req-1"}, {"req-2"}, {"req-2"}}; !reflect.DeepEqual(requestIDs, want) {
+		t.Errorf("requestIDs = %v, want %v", requestIDs, want)
+	}
+}
+
+func TestMutationQueueRunsLoadBalancersInParallel(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+
+	q := newMutationQueue(make(chan struct{}, 2), func(loadBalancerID string, kind mutationKind, targets []*clb.BatchTarget) ([]string, error) {
+		started <- loadBalancerID
+		<-release
+		return nil, nil
+	})
+
+	var wg sync.WaitGroup
+	for _, lb := range []string{"lb-1", "lb-2"} {
+		wg.Add(1)
+		go func(lb string) {
+			defer wg.Done()
+			q.submit(lb, mutationDeregister, []*clb.BatchTarget{newBatchTarget("lbl-1", "", "10.0.0.1", 80)})
+		}(lb)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("load balancers were not processed in parallel")
+		}
+	}
+	close(release)
+	wg.Wait()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
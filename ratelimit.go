@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 每个 API 的默认 QPS，CLB 接口默认频率限制为 20 次/秒，这里只使用一半以便与其他工具共享配额
+const defaultRateLimitQPS = 10
+
+// rateLimit 描述一个令牌桶的速率与容量
+type rateLimit struct {
+	qps   float64
+	burst int
+}
+
+// apiRateLimiter 为每个 CLB API 维护一个令牌桶
+type apiRateLimiter struct {
+	mu           sync.Mutex
+	limiters     map[string]*rate.Limiter
+	limits       map[string]rateLimit
+	defaultLimit rateLimit
+}
+
+func newAPIRateLimiter(defaultLimit rateLimit, limits map[string]rateLimit) *apiRateLimiter {
+	return &apiRateLimiter{
+		limiters:     make(map[string]*rate.Limiter),
+		limits:       limits,
+		defaultLimit: defaultLimit,
+	}
+}
+
+// rateLimitsFromEnv 读取 CLB_RATE_LIMIT（所有 API 的默认 QPS，0 表示不限速）
+// 和 CLB_RATE_LIMITS（按 API 覆盖，如 "DescribeTargets=5:10,BatchRegisterTargets=2"）
+func rateLimitsFromEnv() (rateLimit, map[string]rateLimit, error) {
+	defaultLimit := rateLimit{qps: defaultRateLimitQPS, burst: defaultRateLimitQPS}
+	if value := os.Getenv("CLB_RATE_LIMIT"); value != "" {
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			return rateLimit{}, nil, fmt.Errorf("invalid CLB_RATE_LIMIT %q: %v", value, err)
+		}
+		defaultLimit = limit
+	}
+
+	limits, err := parseRateLimits(os.Getenv("CLB_RATE_LIMITS"))
+	if err != nil {
+		return rateLimit{}, nil, fmt.Errorf("invalid CLB_RATE_LIMITS: %v", err)
+	}
+
+	return defaultLimit, limits, nil
+}
+
+// parseRateLimit 解析 "qps" 或 "qps:burst"，未指定 burst 时取 qps 向上取整
+func parseRateLimit(value string) (rateLimit, error) {
+	qpsValue, burstValue, hasBurst := strings.Cut(strings.TrimSpace(value), ":")
+
+	qps, err := strconv.ParseFloat(qpsValue, 64)
+	if err != nil || qps < 0 {
+		return rateLimit{}, fmt.Errorf("qps must be a non-negative number")
+	}
+
+	burst := int(qps)
+	if float64(burst) < qps {
+		burst++
+	}
+	if hasBurst {
+		burst, err = strconv.Atoi(burstValue)
+		if err != nil || burst <= 0 {
+			return rateLimit{}, fmt.Errorf("burst must be a positive integer")
+		}
+	}
+	return rateLimit{qps: qps, burst: burst}, nil
+}
+
+func parseRateLimits(value string) (map[string]rateLimit, error) {
+	limits := make(map[string]rateLimit)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		action, limitValue, ok := strings.Cut(item, "=")
+		if !ok || action == "" {
+			return nil, fmt.Errorf("%q must be in the form Action=qps[:burst]", item)
+		}
+		limit, err := parseRateLimit(limitValue)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", action, err)
+		}
+		limits[strings.TrimSpace(action)] = limit
+	}
+	return limits, nil
+}
+
+func (r *apiRateLimiter) limiter(action string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.limiters[action]
+	if !ok {
+		limit, found := r.limits[action]
+		if !found {
+			limit = r.defaultLimit
+		}
+		if limit.qps == 0 {
+			l = rate.NewLimiter(rate.Inf, 0)
+		} else {
+			l = rate.NewLimiter(rate.Limit(limit.qps), limit.burst)
+		}
+		r.limiters[action] = l
+	}
+	return l
+}
+
+// wait 阻塞直到 action 获得令牌，并记录等待时间
+func (r *apiRateLimiter) wait(ctx context.Context, action string) error {
+	start := time.Now()
+	err := r.limiter(action).Wait(ctx)
+	clbRateLimitWaitSeconds.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("rate limit wait for %s: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]rateLimit
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: map[string]rateLimit{}},
+		{
+			name:  "qps only",
+			value: "DescribeTargets=5",
+			want:  map[string]rateLimit{"DescribeTargets": {qps: 5, burst: 5}},
+		},
+		{
+			name:  "fractional qps rounds burst up",
+			value: "BatchRegisterTargets=0.5",
+			want:  map[string]rateLimit{"BatchRegisterTargets": {qps: 0.5, burst: 1}},
+		},
+		{
+			name:  "multiple with burst",
+			value: "DescribeTargets=5:10, BatchDeregisterTargets=2",
+			want: map[string]rateLimit{
+				"DescribeTargets":        {qps: 5, burst: 10},
+				"BatchDeregisterTargets": {qps: 2, burst: 2},
+			},
+		},
+		{name: "missing qps", value: "DescribeTargets", wantErr: true},
+		{name: "negative qps", value: "DescribeTargets=-1", wantErr: true},
+		{name: "invalid burst", value: "DescribeTargets=5:0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRateLimits(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRateLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRateLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIRateLimiterPerAction(t *testing.T) {
+	r := newAPIRateLimiter(rateLimit{qps: 10, burst: 10}, map[string]rateLimit{
+		"DescribeTargets":    {qps: 1, burst: 2},
+		"DescribeTaskStatus": {qps: 0},
+	})
+
+	if l := r.limiter("DescribeTargets"); l.Burst() != 2 {
+		t.Errorf("DescribeTargets burst = %d, want 2", l.Burst())
+	}
+	if l := r.limiter("BatchRegisterTargets"); l.Burst() != 10 {
+		t.Errorf("BatchRegisterTargets burst = %d, want default 10", l.Burst())
+	}
+	if r.limiter("DescribeTargets") != r.limiter("DescribeTargets") {
+		t.Error("limiter should be reused for the same action")
+	}
+	if l := r.limiter("DescribeTaskStatus"); !l.Allow() || !l.Allow() {
+		t.Error("qps 0 should disable rate limiting")
+	}
+}
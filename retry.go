@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	tcerr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+)
+
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 200 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+	defaultCallTimeout      = 30 * time.Second
+)
+
+// 可重试的错误码，按 "." 分段匹配，
+// 如 RequestLimitExceeded.UinLimitExceeded、FailedOperation.ResourceInOperation
+var retryableErrorCodes = map[string]struct{}{
+	"RequestLimitExceeded": {},
+	"ResourceInOperation":  {},
+	"InternalError":        {},
+	"NetworkError":         {},
+}
+
+// retryPolicy 描述一次 API 调用的重试策略
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// 单次调用（包含所有重试）的总时限
+	callTimeout time.Duration
+}
+
+func newRetryPolicyFromEnv() (retryPolicy, error) {
+	var p retryPolicy
+	var err error
+
+	if p.maxAttempts, err = envInt("CLB_RETRY_MAX_ATTEMPTS", defaultRetryMaxAttempts); err != nil {
+		return p, err
+	}
+	if p.baseDelay, err = envDuration("CLB_RETRY_BASE_DELAY", defaultRetryBaseDelay); err != nil {
+		return p, err
+	}
+	if p.maxDelay, err = envDuration("CLB_RETRY_MAX_DELAY", defaultRetryMaxDelay); err != nil {
+		return p, err
+	}
+	if p.callTimeout, err = envDuration("CLB_CALL_TIMEOUT", defaultCallTimeout); err != nil {
+		return p, err
+	}
+
+	if p.maxAttempts <= 0 {
+		return p, fmt.Errorf("CLB_RETRY_MAX_ATTEMPTS must be greater than 0")
+	}
+	if p.baseDelay <= 0 || p.maxDelay < p.baseDelay {
+		return p, fmt.Errorf("CLB_RETRY_BASE_DELAY must be positive and not greater than CLB_RETRY_MAX_DELAY")
+	}
+	if p.callTimeout <= 0 {
+		return p, fmt.Errorf("CLB_CALL_TIMEOUT must be greater than 0")
+	}
+	return p, nil
+}
+
+// isRetryableError 判断错误是否为限流、资源操作中、内部错误或网络超时等临时错误
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var sdkErr *tcerr.TencentCloudSDKError
+	if errors.As(err, &sdkErr) {
+		for _, part := range strings.Split(sdkErr.Code, ".") {
+			if _, found := retryableErrorCodes[part]; found {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// backoff 返回第 attempt 次失败后的等待时间（带完全抖动的指数退避）
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.baseDelay << uint(shift); d > 0 && d < p.maxDelay {
+			delay = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// do 执行 fn，遇到可重试错误时按退避策略重试，直到成功、遇到永久错误、
+// 达到最大次数或超过单次调用时限
+func (p retryPolicy) do(action string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.callTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isRetryableError(err) {
+			return err
+		}
+		if attempt >= p.maxAttempts {
+			return fmt.Errorf("%s failed after %d attempts: %w", action, attempt, err)
+		}
+
+		delay := p.backoff(attempt)
+		log.Warnf("%s failed with retryable error (attempt %d/%d), retrying in %v: %v",
+			action, attempt, p.maxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s deadline exceeded after %d attempts: %w", action, attempt, err)
+		case <-timer.C:
+		}
+	}
+}
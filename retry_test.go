@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	tcerr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+)
+
+var testRetryPolicy = retryPolicy{
+	maxAttempts: 3,
+	baseDelay:   time.Millisecond,
+	maxDelay:    2 * time.Millisecond,
+	callTimeout: time.Second,
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "rate limited", err: tcerr.NewTencentCloudSDKError("RequestLimitExceeded", "", ""), want: true},
+		{name: "rate limited subcode", err: tcerr.NewTencentCloudSDKError("RequestLimitExceeded.UinLimitExceeded", "", ""), want: true},
+		{name: "resource in operation", err: tcerr.NewTencentCloudSDKError("FailedOperation.ResourceInOperation", "", ""), want: true},
+		{name: "internal error", err: tcerr.NewTencentCloudSDKError("InternalError", "", ""), want: true},
+		{name: "sdk network error", err: tcerr.NewTencentCloudSDKError("ClientError.NetworkError", "", ""), want: true},
+		{name: "invalid parameter", err: tcerr.NewTencentCloudSDKError("InvalidParameter.LBIdNotFound", "", ""), want: false},
+		{name: "auth failure", err: tcerr.NewTencentCloudSDKError("AuthFailure.SignatureFailure", "", ""), want: false},
+		{name: "network timeout", err: fmt.Errorf("post: %w", timeoutError{}), want: true},
+		{name: "plain error", err: fmt.Errorf("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	t.Run("retries until success", func(t *testing.T) {
+		attempts := 0
+		err := testRetryPolicy.do("test", func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return tcerr.NewTencentCloudSDKError("RequestLimitExceeded", "", "")
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("do() = %v after %d attempts, want nil after 3", err, attempts)
+		}
+	})
+
+	t.Run("stops on permanent error", func(t *testing.T) {
+		attempts := 0
+		err := testRetryPolicy.do("test", func(ctx context.Context) error {
+			attempts++
+			return tcerr.NewTencentCloudSDKError("InvalidParameter", "", "")
+		})
+		if err == nil || attempts != 1 {
+			t.Errorf("do() = %v after %d attempts, want error after 1", err, attempts)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		attempts := 0
+		err := testRetryPolicy.do("test", func(ctx context.Context) error {
+			attempts++
+			return tcerr.NewTencentCloudSDKError("InternalError", "", "")
+		})
+		if err == nil || attempts != testRetryPolicy.maxAttempts {
+			t.Errorf("do() = %v after %d attempts, want error after %d", err, attempts, testRetryPolicy.maxAttempts)
+		}
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt := 1; attempt <= 40; attempt++ {
+		if d := p.backoff(attempt); d <= 0 || d > p.maxDelay {
+			t.Errorf("backoff(%d) = %v, want in (0, %v]", attempt, d, p.maxDelay)
+		}
+	}
+}
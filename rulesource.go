@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ConfigMap 中默认的规则 key
+const defaultRulesConfigMapKey = "rules.yaml"
+
+// rulesSource 提供规则内容及其版本
+type rulesSource interface {
+	// String 返回用于日志和状态展示的来源描述
+	String() string
+	// read 返回当前的规则文件和版本
+	read() (docs []rulesDocument, version string, err error)
+	// watch 在后台监听规则变化，变化时调用 notify
+	watch(ctx context.Context, notify func()) error
+}
+
+// rulesDocument 是一个规则文件的内容
+type rulesDocument struct {
+	name string
+	data []byte
+}
+
+// rulesOptions 描述规则的来源，依次优先使用 ConfigMap、规则目录和本地文件
+type rulesOptions struct {
+	path         string
+	dir          string
+	configMap    string
+	configMapKey string
+}
+
+func newRulesSource(clientset kubernetes.Interface, opts rulesOptions) (rulesSource, error) {
+	if opts.configMap == "" {
+		if opts.dir != "" {
+			return newDirRulesSource(opts.dir), nil
+		}
+		return newFileRulesSource(opts.path), nil
+	}
+
+	namespace, name, err := parseConfigMapRef(opts.configMap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules configmap: %v", err)
+	}
+
+	key := opts.configMapKey
+	if key == "" {
+		key = defaultRulesConfigMapKey
+	}
+	return newConfigMapRulesSource(clientset, namespace, name, key), nil
+}
+
+// fileRulesSource 从本地文件读取规则，版本为文件内容的摘要
+type fileRulesSource struct {
+	path string
+}
+
+func newFileRulesSource(path string) *fileRulesSource {
+	return &fileRulesSource{path: path}
+}
+
+func (s *fileRulesSource) String() string {
+	return s.path
+}
+
+func (s *fileRulesSource) read() ([]rulesDocument, string, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, "", err
+	}
+	docs := []rulesDocument{{name: s.path, data: data}}
+	return docs, documentsVersion(docs), nil
+}
+
+// dirRulesSource 读取目录中所有的 *.yaml 和 *.yml 文件，按文件名排序
+type dirRulesSource struct {
+	dir string
+}
+
+func newDirRulesSource(dir string) *dirRulesSource {
+	return &dirRulesSource{dir: dir}
+}
+
+func (s *dirRulesSource) String() string {
+	return s.dir
+}
+
+func (s *dirRulesSource) read() ([]rulesDocument, string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var docs []rulesDocument
+	for _, entry := range entries {
+		// 跳过目录以及 ConfigMap 挂载产生的 ..data 等隐藏文件
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !isRulesFileName(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		docs = append(docs, rulesDocument{name: path, data: data})
+	}
+	return docs, documentsVersion(docs), nil
+}
+
+func isRulesFileName(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// documentsVersion 返回规则文件名和内容摘要的前 12 位
+func documentsVersion(docs []rulesDocument) string {
+	hash := sha256.New()
+	for _, doc := range docs {
+		hash.Write([]byte(doc.name))
+		hash.Write([]byte{0})
+		hash.Write(doc.data)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// configMapRulesSource 通过 informer 监听 ConfigMap 中的规则，版本为 ConfigMap 的 resourceVersion
+type configMapRulesSource struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	key       string
+
+	mu      sync.Mutex
+	data    []byte
+	version string
+	loaded  bool
+}
+
+func newConfigMapRulesSource(clientset kubernetes.Interface, namespace, name, key string) *configMapRulesSource {
+	return &configMapRulesSource{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		key:       key,
+	}
+}
+
+func (s *configMapRulesSource) String() string {
+	return fmt.Sprintf("configmap/%s/%s[%s]", s.namespace, s.name, s.key)
+}
+
+// read 优先返回 informer 缓存的内容，尚未缓存时直接从 API 读取
+func (s *configMapRulesSource) read() ([]rulesDocument, string, error) {
+	s.mu.Lock()
+	if s.loaded {
+		data, version := s.data, s.version
+		s.mu.Unlock()
+		return []rulesDocument{{name: s.String(), data: data}}, version, nil
+	}
+	s.mu.Unlock()
+
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := s.extract(cm)
+	if err != nil {
+		return nil, "", err
+	}
+	s.store(data, cm.ResourceVersion)
+	return []rulesDocument{{name: s.String(), data: data}}, cm.ResourceVersion, nil
+}
+
+func (s *configMapRulesSource) extract(cm *corev1.ConfigMap) ([]byte, error) {
+	data, ok := cm.Data[s.key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in configmap %s/%s", s.key, s.namespace, s.name)
+	}
+	return []byte(data), nil
+}
+
+// store 保存新内容，版本未变化时返回 false
+func (s *configMapRulesSource) store(data []byte, version string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loaded && s.version == version {
+		return false
+	}
+	s.data = data
+	s.version = version
+	s.loaded = true
+	return true
+}
+
+func (s *configMapRulesSource) watch(ctx context.Context, notify func()) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, 0,
+		informers.WithNamespace(s.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", s.name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	update := func(obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		data, err := s.extract(cm)
+		if err != nil {
+			log.Errorf("Ignoring configmap update, keeping previous rules: %v", err)
+			return
+		}
+		if s.store(data, cm.ResourceVersion) {
+			log.Infof("Rules configmap %s/%s changed, resourceVersion %s", s.namespace, s.name, cm.ResourceVersion)
+			notify()
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+		DeleteFunc: func(interface{}) {
+			log.Warningf("Rules configmap %s/%s deleted, keeping previous rules", s.namespace, s.name)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add configmap event handler: %v", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync configmap %s/%s", s.namespace, s.name)
+	}
+	log.Infof("Watching %s for changes", s)
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newRulesConfigMap(resourceVersion string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ops",
+			Name:            "clb-rules",
+			ResourceVersion: resourceVersion,
+		},
+		Data: data,
+	}
+}
+
+func TestNewRulesSource(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "controller")
+
+	tests := []struct {
+		name    string
+		opts    rulesOptions
+		want    string
+		wantErr bool
+	}{
+		{"file", rulesOptions{path: "rules.yaml"}, "rules.yaml", false},
+		{"configmap with namespace", rulesOptions{configMap: "ops/clb-rules", configMapKey: "rules.yaml"}, "configmap/ops/clb-rules[rules.yaml]", false},
+		{"configmap in pod namespace", rulesOptions{configMap: "clb-rules"}, "configmap/controller/clb-rules[rules.yaml]", false},
+		{"missing name", rulesOptions{configMap: "ops/"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := newRulesSource(fake.NewSimpleClientset(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRulesSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && source.String() != tt.want {
+				t.Errorf("newRulesSource() = %s, want %s", source, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileRulesSourceVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	source := newFileRulesSource(path)
+
+	os.WriteFile(path, []byte("[]\n"), 0o644)
+	_, first, err := source.read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+
+	os.WriteFile(path, []byte("# changed\n[]\n"), 0o644)
+	_, second, err := source.read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+
+	if first == "" || first == second {
+		t.Errorf("read() versions = %q, %q, want distinct non-empty versions", first, second)
+	}
+}
+
+func TestDirRulesSourceRead(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("[]\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "a.yml"), []byte("[]\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("ignored"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".hidden.yaml"), []byte("ignored"), 0o644)
+	os.Mkdir(filepath.Join(dir, "sub.yaml"), 0o755)
+
+	docs, version, err := newDirRulesSource(dir).read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+
+	var names []string
+	for _, doc := range docs {
+		names = append(names, filepath.Base(doc.name))
+	}
+	if !reflect.DeepEqual(names, []string{"a.yml", "b.yaml"}) {
+		t.Errorf("read() files = %v, want [a.yml b.yaml]", names)
+	}
+	if version == "" {
+		t.Error("read() version is empty")
+	}
+}
+
+func TestConfigMapRulesSourceRead(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newRulesConfigMap("7", map[string]string{"rules.yaml": "[]\n"}))
+
+	docs, version, err := newConfigMapRulesSource(clientset, "ops", "clb-rules", "rules.yaml").read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	if len(docs) != 1 || string(docs[0].data) != "[]\n" || version != "7" {
+		t.Errorf("read() = %v, %q, want [] at version 7", docs, version)
+	}
+
+	if _, _, err := newConfigMapRulesSource(clientset, "ops", "clb-rules", "missing.yaml").read(); err == nil {
+		t.Error("read() with missing key error = nil, want error")
+	}
+}
+
+func TestConfigMapRulesSourceWatch(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newRulesConfigMap("1", map[string]string{"rules.yaml": "[]\n"}))
+	source := newConfigMapRulesSource(clientset, "ops", "clb-rules", "rules.yaml")
+
+	if _, _, err := source.read(); err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+
+	notified := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := source.watch(ctx, func() { notified <- struct{}{} }); err != nil {
+		t.Fatalf("watch() error = %v", err)
+	}
+
+	// 已加载的版本不应再次触发通知
+	if len(notified) != 0 {
+		t.Fatalf("watch() notified %d times for unchanged version", len(notified))
+	}
+
+	updated := newRulesConfigMap("2", map[string]string{"rules.yaml": "# v2\n[]\n"})
+	if _, err := clientset.CoreV1().ConfigMaps("ops").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(notified) > 0 })
+	docs, version, err := source.read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	if len(docs) != 1 || string(docs[0].data) != "# v2\n[]\n" || version != "2" {
+		t.Errorf("read() = %v, %q, want updated rules at version 2", docs, version)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// v2 规则格式的 apiVersion
+const rulesAPIVersionV2 = "v2"
+
+// RulesV2 是 v2 格式的规则文件。后端配置可以在文件、负载均衡器和监听器三级设置默认值，
+// 转发规则中未设置的字段从最近一级的默认值继承
+type RulesV2 struct {
+	APIVersion    string           `yaml:"apiVersion"`
+	Defaults      DefaultsV2       `yaml:"defaults,omitempty"`
+	LoadBalancers []LoadBalancerV2 `yaml:"loadBalancers"`
+}
+
+type DefaultsV2 struct {
+	Backend BackendV2 `yaml:"backend,omitempty"`
+}
+
+type LoadBalancerV2 struct {
+	ID string `yaml:"id"`
+	// 负载均衡器所在区域，为空时使用 TENCENT_REGION
+	Region string `yaml:"region,omitempty"`
+	// 凭证配置名，为空时使用默认凭证
+	CredentialProfile string       `yaml:"credentialProfile,omitempty"`
+	Defaults          DefaultsV2   `yaml:"defaults,omitempty"`
+	Listeners         []ListenerV2 `yaml:"listeners"`
+}
+
+type ListenerV2 struct {
+	Protocol string     `yaml:"protocol"`
+	Port     int        `yaml:"port"`
+	Defaults DefaultsV2 `yaml:"defaults,omitempty"`
+	Rules    []RuleV2   `yaml:"rules"`
+}
+
+type RuleV2 struct {
+	Domain   string           `yaml:"domain"`
+	URL      string           `yaml:"url"`
+	Backend  BackendV2        `yaml:"backend,omitempty"`
+	Backends []SplitBackendV2 `yaml:"backends,omitempty"`
+}
+
+// SplitBackendV2 是按比例分配流量的后端，未设置的字段同样从默认值继承（权重除外）
+type SplitBackendV2 struct {
+	BackendV2 `yaml:",inline"`
+	Share     int `yaml:"share"`
+}
+
+type BackendV2 struct {
+	Namespace  string        `yaml:"namespace,omitempty"`
+	Deployment string        `yaml:"deployment,omitempty"`
+	Port       int           `yaml:"port,omitempty"`
+	Weight     *int          `yaml:"weight,omitempty"`
+	SlowStart  time.Duration `yaml:"slowStart,omitempty"`
+	Safety     SafetyV2      `yaml:"safety,omitempty"`
+}
+
+// SafetyV2 是 v2 格式中的解绑安全限制，字段含义与 SafetyConfig 相同
+type SafetyV2 struct {
+	MinBackends       int `yaml:"minBackends,omitempty"`
+	MinPercent        int `yaml:"minPercent,omitempty"`
+	MaxRemovalPercent int `yaml:"maxRemovalPercent,omitempty"`
+}
+
+// backendLevel 是某一级的后端配置及其所在的 yaml 节点
+type backendLevel struct {
+	backend BackendV2
+	node    *yaml.Node
+}
+
+// defaultsBackendNode 返回 defaults.backend 所在的节点
+func defaultsBackendNode(node *yaml.Node) *yaml.Node {
+	return fieldNode(fieldNode(node, "defaults"), "backend")
+}
+
+// inheritBackend 按从通用到具体的顺序合并各级后端配置，并记录每个字段最终来自哪个节点
+func inheritBackend(levels ...backendLevel) (BackendConfig, bindingNodes) {
+	var backend BackendConfig
+	var nodes bindingNodes
+	for _, level := range levels {
+		if level.backend.Namespace != "" {
+			backend.Namespace = level.backend.Namespace
+			nodes.namespace = fieldNode(level.node, "namespace")
+		}
+		if level.backend.Deployment != "" {
+			backend.Deployment = level.backend.Deployment
+			nodes.deployment = fieldNode(level.node, "deployment")
+		}
+		if level.backend.Port != 0 {
+			backend.Port = level.backend.Port
+			nodes.port = fieldNode(level.node, "port")
+		}
+		if level.backend.Weight != nil {
+			backend.Weight = level.backend.Weight
+			nodes.weight = fieldNode(level.node, "weight")
+		}
+		if level.backend.SlowStart != 0 {
+			backend.SlowStart = level.backend.SlowStart
+			nodes.slowStart = fieldNode(level.node, "slowStart")
+		}
+		// 安全限制作为一个整体继承
+		if level.backend.Safety != (SafetyV2{}) {
+			backend.Safety = SafetyConfig(level.backend.Safety)
+			nodes.safety = fieldNode(level.node, "safety")
+		}
+	}
+	return backend, nodes
+}
+
+// parseRulesV2 解析 v2 格式的规则，并展开为内部使用的规则
+func parseRulesV2(data []byte, doc *yaml.Node) ([]RuleConfig, []ruleNodes, error) {
+	var v2 RulesV2
+	if err := decodeStrict(data, &v2); err != nil {
+		return nil, nil, err
+	}
+	if v2.APIVersion != rulesAPIVersionV2 {
+		line := lineOf(fieldNode(doc, "apiVersion"), doc)
+		return nil, nil, ValidationErrors{{Line: line, Message: fmt.Sprintf("unsupported apiVersion %q, expected %s", v2.APIVersion, rulesAPIVersionV2)}}
+	}
+
+	rules, nodes := expandRulesV2(v2, doc)
+	return rules, nodes, nil
+}
+
+// expandRulesV2 将 v2 规则展开为内部使用的规则，doc 为 nil 时不记录节点
+func expandRulesV2(v2 RulesV2, doc *yaml.Node) ([]RuleConfig, []ruleNodes) {
+	var rules []RuleConfig
+	var nodes []ruleNodes
+
+	global := backendLevel{v2.Defaults.Backend, defaultsBackendNode(doc)}
+	lbNodes := sequenceItems(fieldNode(doc, "loadBalancers"))
+	for i, lb := range v2.LoadBalancers {
+		lbNode := nodeAt(lbNodes, i)
+		lbLevel := backendLevel{lb.Defaults.Backend, defaultsBackendNode(lbNode)}
+
+		rule := RuleConfig{
+			LoadBalancerID:    lb.ID,
+			Region:            lb.Region,
+			CredentialProfile: lb.CredentialProfile,
+		}
+		r := ruleNodes{node: lbNode, id: fieldNode(lbNode, "id")}
+
+		listenerNodeList := sequenceItems(fieldNode(lbNode, "listeners"))
+		for j, listener := range lb.Listeners {
+			listenerNode := nodeAt(listenerNodeList, j)
+			listenerLevel := backendLevel{listener.Defaults.Backend, defaultsBackendNode(listenerNode)}
+
+			out := ListenerConfig{Port: listener.Port, Protocol: listener.Protocol}
+			l := listenerNodes{
+				node:     listenerNode,
+				port:     fieldNode(listenerNode, "port"),
+				protocol: fieldNode(listenerNode, "protocol"),
+			}
+
+			ruleNodeList := sequenceItems(fieldNode(listenerNode, "rules"))
+			for k, v2Rule := range listener.Rules {
+				ruleNode := nodeAt(ruleNodeList, k)
+				backendNode := fieldNode(ruleNode, "backend")
+				outRule := ListenerRuleConfig{Domain: v2Rule.Domain, URL: v2Rule.URL}
+				var b bindingNodes
+				if len(v2Rule.Backends) == 0 || v2Rule.Backend != (BackendV2{}) {
+					outRule.Backend, b = inheritBackend(global, lbLevel, listenerLevel, backendLevel{v2Rule.Backend, backendNode})
+				}
+				b.node = ruleNode
+				b.backend = backendNode
+
+				b.split = fieldNode(ruleNode, "backends")
+				memberNodes := sequenceItems(b.split)
+				for m, member := range v2Rule.Backends {
+					memberNode := nodeAt(memberNodes, m)
+					backend, mb := inheritBackend(global, lbLevel, listenerLevel, backendLevel{member.BackendV2, memberNode})
+					// 按比例分配流量时权重由比例计算，不继承默认权重
+					backend.Weight = member.Weight
+					mb.weight = fieldNode(memberNode, "weight")
+					mb.node = memberNode
+					mb.backend = memberNode
+					mb.share = fieldNode(memberNode, "share")
+
+					outRule.Backends = append(outRule.Backends, SplitBackendConfig{BackendConfig: backend, Share: member.Share})
+					b.members = append(b.members, mb)
+				}
+
+				out.Rules = append(out.Rules, outRule)
+				l.rules = append(l.rules, b)
+			}
+
+			rule.Listeners = append(rule.Listeners, out)
+			r.listeners = append(r.listeners, l)
+		}
+
+		rules = append(rules, rule)
+		nodes = append(nodes, r)
+	}
+	return rules, nodes
+}
+
+func nodeAt(nodes []*yaml.Node, i int) *yaml.Node {
+	if i < len(nodes) {
+		return nodes[i]
+	}
+	return nil
+}
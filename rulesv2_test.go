@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const v2Rules = `apiVersion: v2
+defaults:
+  backend:
+    namespace: default
+    port: 8080
+loadBalancers:
+  - id: lb-abcd1234
+    region: ap-guangzhou
+    defaults:
+      backend:
+        port: 9090
+        slowStart: 30s
+    listeners:
+      - protocol: https
+        port: 443
+        rules:
+          - domain: a.example.com
+            url: /
+            backend:
+              deployment: web
+          - domain: a.example.com
+            url: /api
+            backend:
+              deployment: api
+              port: 7070
+`
+
+func TestParseRulesV2Inheritance(t *testing.T) {
+	rules, err := parseRules([]byte(v2Rules))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+
+	want := []RuleConfig{{
+		LoadBalancerID: "lb-abcd1234",
+		Region:         "ap-guangzhou",
+		Listeners: []ListenerConfig{{
+			Port:     443,
+			Protocol: "https",
+			Rules: []ListenerRuleConfig{
+				{Domain: "a.example.com", URL: "/", Backend: BackendConfig{Namespace: "default", Deployment: "web", Port: 9090, SlowStart: 30 * time.Second}},
+				{Domain: "a.example.com", URL: "/api", Backend: BackendConfig{Namespace: "default", Deployment: "api", Port: 7070, SlowStart: 30 * time.Second}},
+			},
+		}},
+	}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("parseRules() = %+v, want %+v", rules, want)
+	}
+}
+
+func TestParseRulesV2Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantLines []int
+		wantMsg   string
+	}{
+		{
+			name:      "unsupported api version",
+			data:      strings.Replace(v2Rules, "apiVersion: v2", "apiVersion: v3", 1),
+			wantLines: []int{1},
+			wantMsg:   "unsupported apiVersion",
+		},
+		{
+			name:      "unknown field",
+			data:      strings.Replace(v2Rules, "region:", "regoin:", 1),
+			wantLines: []int{8},
+			wantMsg:   "field regoin not found",
+		},
+		{
+			name:      "invalid inherited port points at the defaults",
+			data:      strings.Replace(v2Rules, "port: 9090", "port: 70000", 1),
+			wantLines: []int{11},
+			wantMsg:   "backend port 70000 out of range",
+		},
+		{
+			name:      "missing deployment points at the rule",
+			data:      strings.Replace(v2Rules, "              deployment: web\n", "", 1),
+			wantLines: []int{19},
+			wantMsg:   "backend deployment must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRules([]byte(tt.data))
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("parseRules() error = %v, want ValidationErrors", err)
+			}
+			var lines []int
+			for _, e := range errs {
+				lines = append(lines, e.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("parseRules() error lines = %v, want %v (%v)", lines, tt.wantLines, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("parseRules() error = %v, want message containing %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestParseRulesV2Split(t *testing.T) {
+	data := strings.Replace(v2Rules, `          - domain: a.example.com
+            url: /api
+            backend:
+              deployment: api
+              port: 7070
+`, `          - domain: a.example.com
+            url: /api
+            backends:
+              - deployment: api-stable
+                share: 90
+              - deployment: api-canary
+                port: 7070
+                share: 10
+`, 1)
+	rules, err := parseRules([]byte(data))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+
+	got := rules[0].Listeners[0].Rules[1]
+	want := ListenerRuleConfig{
+		Domain: "a.example.com",
+		URL:    "/api",
+		Backends: []SplitBackendConfig{
+			{BackendConfig: BackendConfig{Namespace: "default", Deployment: "api-stable", Port: 9090, SlowStart: 30 * time.Second}, Share: 90},
+			{BackendConfig: BackendConfig{Namespace: "default", Deployment: "api-canary", Port: 7070, SlowStart: 30 * time.Second}, Share: 10},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRules() rule = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Deployment 上跳过解绑安全限制的注解，值为 "true" 时生效
+const deregistrationOverrideAnnotation = "clb.tencent/deregistration-override"
+
+// SafetyConfig 是解绑后端时的安全限制，字段为 0 时不限制
+type SafetyConfig struct {
+	// 解绑后转发规则上至少保留的后端数量
+	MinBackends int `yaml:"min_backends,omitempty"`
+	// 解绑后至少保留的后端比例（百分比）
+	MinPercent int `yaml:"min_percent,omitempty"`
+	// 单次同步最多解绑的后端比例（百分比）
+	MaxRemovalPercent int `yaml:"max_removal_percent,omitempty"`
+}
+
+// check 检查从 current 个后端中解绑 removed 个是否违反安全限制
+func (s SafetyConfig) check(current, removed int) error {
+	if removed == 0 || current == 0 {
+		return nil
+	}
+	remaining := current - removed
+	if s.MinBackends > 0 && remaining < s.MinBackends {
+		return fmt.Errorf("removing %d of %d backends would leave %d, below the minimum of %d", removed, current, remaining, s.MinBackends)
+	}
+	if s.MinPercent > 0 && remaining*100 < s.MinPercent*current {
+		return fmt.Errorf("removing %d of %d backends would leave %d%%, below the minimum of %d%%", removed, current, remaining*100/current, s.MinPercent)
+	}
+	if s.MaxRemovalPercent > 0 && removed*100 > s.MaxRemovalPercent*current {
+		return fmt.Errorf("removing %d of %d backends (%d%%) exceeds the maximum of %d%% per sync", removed, current, removed*100/current, s.MaxRemovalPercent)
+	}
+	return nil
+}
+
+// validate 返回安全限制中无效的字段
+func (s SafetyConfig) validate() []string {
+	var msgs []string
+	if s.MinBackends < 0 {
+		msgs = append(msgs, fmt.Sprintf("safety min backends %d must not be negative", s.MinBackends))
+	}
+	if s.MinPercent < 0 || s.MinPercent > 100 {
+		msgs = append(msgs, fmt.Sprintf("safety min percent %d out of range 0-100", s.MinPercent))
+	}
+	if s.MaxRemovalPercent < 0 || s.MaxRemovalPercent > 100 {
+		msgs = append(msgs, fmt.Sprintf("safety max removal percent %d out of range 0-100", s.MaxRemovalPercent))
+	}
+	return msgs
+}
+
+// newEventRecorder 创建向 API Server 写入事件的 EventRecorder。相同的事件会被合并为一个并累加次数，
+// 短时间内大量相似的事件也会被聚合，解绑持续被阻止时不会每次同步都创建新的事件
+func newEventRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "sync-pod-to-clb"})
+}
+
+// recordDeregistrationBlocked 在 Deployment 上记录解绑被安全限制阻止的告警事件
+func (pc *PodController) recordDeregistrationBlocked(namespace, deploymentName string, target ConfigTarget, reason error) {
+	deployment := &corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Namespace:  namespace,
+		Name:       deploymentName,
+	}
+	pc.recorder.Eventf(deployment, corev1.EventTypeWarning, "DeregistrationBlocked",
+		"Deregistration from %s %s/%s blocked: %v. Set annotation %s=true on the deployment to override",
+		target.LoadBalancerID, target.ListenerID, target.LocationID, reason, deregistrationOverrideAnnotation)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSafetyConfigCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		safety  SafetyConfig
+		current int
+		removed int
+		wantErr string
+	}{
+		{name: "no limits", current: 4, removed: 4},
+		{name: "nothing removed", safety: SafetyConfig{MinBackends: 10}, current: 4, removed: 0},
+		{name: "min backends kept", safety: SafetyConfig{MinBackends: 2}, current: 4, removed: 2},
+		{name: "min backends violated", safety: SafetyConfig{MinBackends: 2}, current: 4, removed: 3, wantErr: "below the minimum of 2"},
+		{name: "min percent kept", safety: SafetyConfig{MinPercent: 50}, current: 4, removed: 2},
+		{name: "min percent violated", safety: SafetyConfig{MinPercent: 50}, current: 4, removed: 3, wantErr: "below the minimum of 50%"},
+		{name: "all removed", safety: SafetyConfig{MinPercent: 1}, current: 4, removed: 4, wantErr: "leave 0%"},
+		{name: "max removal kept", safety: SafetyConfig{MaxRemovalPercent: 25}, current: 4, removed: 1},
+		{name: "max removal violated", safety: SafetyConfig{MaxRemovalPercent: 25}, current: 4, removed: 2, wantErr: "exceeds the maximum of 25%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.safety.check(tt.current, tt.removed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("check() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordDeregistrationBlockedAggregatesEvents(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	pc := &PodController{recorder: newEventRecorder(clientset)}
+	target := ConfigTarget{LoadBalancerID: "lb-abcd1234", ListenerID: "lbl-1", LocationID: "loc-1"}
+
+	// 解绑持续被阻止时，每次同步记录的事件应合并为同一个事件
+	for i := 0; i < 3; i++ {
+		pc.recordDeregistrationBlocked("default", "web", target, errors.New("would leave 1 backends, minimum is 2"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(events.Items) == 1 && events.Items[0].Count == 3 {
+			event := events.Items[0]
+			if event.Reason != "DeregistrationBlocked" || event.InvolvedObject.Kind != "Deployment" || event.InvolvedObject.Name != "web" {
+				t.Errorf("event = %+v, want DeregistrationBlocked on deployment web", event)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events = %+v, want one event with count 3", events.Items)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// 默认 HTTP 监听地址，提供健康检查和监控指标
+const defaultHTTPAddr = ":8080"
+
+// statusReporter 提供 /status 和 /ready 的内容
+type statusReporter interface {
+	Status() ControllerStatus
+	// Ready 返回 nil 表示控制器已就绪
+	Ready() error
+}
+
+// newHTTPServer 创建 HTTP 服务，admin 为 nil 时不提供管理接口
+func newHTTPServer(addr string, reporter statusReporter, admin *adminAPI) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		status, body := http.StatusOK, "ok"
+		if err := reporter.Ready(); err != nil {
+			status, body = http.StatusServiceUnavailable, err.Error()
+		}
+		// 无效的规则文件、冲突和无法匹配的配置不影响就绪，但同样列在响应中
+		if err := reporter.Status().problems(); err != nil {
+			body += "\n" + err.Error()
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reporter.Status())
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	if admin != nil {
+		admin.register(mux)
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveHTTP 启动 HTTP 服务，并在 ctx 取消时关闭
+func serveHTTP(ctx context.Context, server *http.Server) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("HTTP server listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("HTTP server error: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 默认的慢启动权重调整间隔
+const defaultSlowStartInterval = 10 * time.Second
+
+// slowStartEntry 是一个处于慢启动中的后端
+type slowStartEntry struct {
+	// 后端所属的 namespace/deployment
+	deployment string
+	start      time.Time
+	window     time.Duration
+}
+
+// slowStartTracker 记录控制器新绑定的、配置了慢启动的后端的绑定时间
+type slowStartTracker struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]slowStartEntry
+}
+
+func newSlowStartTracker() *slowStartTracker {
+	return &slowStartTracker{
+		now:     time.Now,
+		entries: make(map[string]slowStartEntry),
+	}
+}
+
+func slowStartKey(target ConfigTarget, ip string) string {
+	return fmt.Sprintf("%s/%s/%s/%s:%d", target.LoadBalancerID, target.ListenerID, target.LocationID, ip, target.Port)
+}
+
+// start 记录后端开始慢启动
+func (t *slowStartTracker) start(target ConfigTarget, deployment, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[slowStartKey(target, ip)] = slowStartEntry{deployment: deployment, start: t.now(), window: target.SlowStart}
+}
+
+// weight 返回后端当前的慢启动权重：从 1 开始随时间线性提高到 full，慢启动结束或未在慢启动中时返回 full
+func (t *slowStartTracker) weight(target ConfigTarget, ip string, full int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[slowStartKey(target, ip)]
+	if !ok {
+		return full
+	}
+	return rampWeight(full, t.now().Sub(entry.start), entry.window)
+}
+
+// active 返回仍有后端处于慢启动中的 Deployment，并丢弃已结束的记录。
+// 已结束的后端在下一次同步时恢复完整权重
+func (t *slowStartTracker) active() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var deployments []string
+	for key, entry := range t.entries {
+		if t.now().Sub(entry.start) >= entry.window {
+			delete(t.entries, key)
+		}
+		// 结束后还需要再同步一次，将权重调整为完整权重
+		if _, ok := seen[entry.deployment]; !ok {
+			seen[entry.deployment] = struct{}{}
+			deployments = append(deployments, entry.deployment)
+		}
+	}
+	sort.Strings(deployments)
+	return deployments
+}
+
+// rampWeight 按已经过的时间在 [1, full] 之间线性插值
+func rampWeight(full int, elapsed, window time.Duration) int {
+	if full <= 0 || window <= 0 || elapsed >= window {
+		return full
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	weight := int(int64(full) * int64(elapsed) / int64(window))
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRampWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		full    int
+		elapsed time.Duration
+		window  time.Duration
+		want    int
+	}{
+		{name: "just registered", full: 100, elapsed: 0, window: time.Minute, want: 1},
+		{name: "halfway", full: 100, elapsed: 30 * time.Second, window: time.Minute, want: 50},
+		{name: "finished", full: 100, elapsed: time.Minute, window: time.Minute, want: 100},
+		{name: "small weight", full: 10, elapsed: 5 * time.Second, window: time.Minute, want: 1},
+		{name: "zero weight", full: 0, elapsed: 0, window: time.Minute, want: 0},
+		{name: "no window", full: 50, elapsed: 0, window: 0, want: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rampWeight(tt.full, tt.elapsed, tt.window); got != tt.want {
+				t.Errorf("rampWeight() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowStartTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newSlowStartTracker()
+	tracker.now = func() time.Time { return now }
+
+	target := testTarget
+	target.SlowStart = time.Minute
+	tracker.start(target, "default/web", "10.0.0.1")
+
+	if got := tracker.weight(target, "10.0.0.1", 40); got != 1 {
+		t.Errorf("weight() at start = %d, want 1", got)
+	}
+	if got := tracker.weight(target, "10.0.0.2", 40); got != 40 {
+		t.Errorf("weight() of untracked backend = %d, want 40", got)
+	}
+
+	now = now.Add(45 * time.Second)
+	if got := tracker.weight(target, "10.0.0.1", 40); got != 30 {
+		t.Errorf("weight() after 45s = %d, want 30", got)
+	}
+	if got, want := tracker.active(), []string{"default/web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("active() = %v, want %v", got, want)
+	}
+
+	// 结束后仍返回一次，以便恢复完整权重
+	now = now.Add(15 * time.Second)
+	if got, want := tracker.active(), []string{"default/web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("active() after window = %v, want %v", got, want)
+	}
+	if got := tracker.weight(target, "10.0.0.1", 40); got != 40 {
+		t.Errorf("weight() after window = %d, want 40", got)
+	}
+	if got := tracker.active(); got != nil {
+		t.Errorf("active() = %v, want nil", got)
+	}
+}
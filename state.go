@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 默认的负载均衡器状态刷新间隔
+const defaultStateRefreshInterval = 60 * time.Second
+
+// lbSnapshot 是负载均衡器最近一次成功获取的监听器、转发规则和后端
+type lbSnapshot struct {
+	listeners []Listener
+	// 按 listenerID/locationID 保存的后端，绑定/解绑完成后会随之更新
+	backends map[string][]Backend
+	// 按 listenerID/locationID 保存的后端权重
+	weights   map[string]map[Backend]int
+	fetchedAt time.Time
+}
+
+// clbState 保存负载均衡器的实际状态。刷新失败时保留上一次成功的快照，
+// 避免 API 临时故障导致已有的绑定关系丢失
+type clbState struct {
+	mu        sync.RWMutex
+	describe  func(loadBalancerID string) ([]Listener, error)
+	snapshots map[string]*lbSnapshot
+	// 每个负载均衡器上记录过的绑定、解绑和权重变更次数，用于丢弃查询期间已过时的结果
+	recorded map[string]uint64
+}
+
+func newCLBState(describe func(loadBalancerID string) ([]Listener, error)) *clbState {
+	return &clbState{
+		describe:  describe,
+		snapshots: make(map[string]*lbSnapshot),
+		recorded:  make(map[string]uint64),
+	}
+}
+
+// refresh 重新获取给定负载均衡器的状态，返回所有失败的负载均衡器的错误
+func (s *clbState) refresh(loadBalancerIDs []string) error {
+	var errs []error
+	for _, id := range loadBalancerIDs {
+		s.mu.RLock()
+		recorded := s.recorded[id]
+		s.mu.RUnlock()
+
+		listeners, err := s.describe(id)
+		if err != nil {
+			log.Errorf("Failed to refresh state of LB %s, keeping last snapshot: %v", id, err)
+			clbStateRefreshErrors.WithLabelValues(id).Inc()
+			errs = append(errs, fmt.Errorf("failed to refresh LB %s: %w", id, err))
+			continue
+		}
+
+		snapshot := &lbSnapshot{
+			listeners: listeners,
+			backends:  make(map[string][]Backend),
+			weights:   make(map[string]map[Backend]int),
+			fetchedAt: time.Now(),
+		}
+		for _, listener := range listeners {
+			for _, rule := range listener.Rules {
+				var backends []Backend
+				weights := make(map[Backend]int)
+				for _, target := range rule.Targets {
+					if len(target.PrivateIPAddresses) > 0 {
+						backend := Backend{
+							IP:   target.PrivateIPAddresses[0],
+							Port: target.Port,
+						}
+						backends = append(backends, backend)
+						weights[backend] = target.Weight
+					}
+				}
+				key := locationKey(listener.ListenerID, rule.LocationID)
+				snapshot.backends[key] = backends
+				snapshot.weights[key] = weights
+			}
+		}
+
+		s.mu.Lock()
+		if s.recorded[id] != recorded {
+			// 查询期间有变更完成，查询结果可能不包含这些变更，保留当前快照，下次刷新时再替换
+			s.mu.Unlock()
+			log.Debugf("Discarding state of LB %s fetched while it was being modified", id)
+			continue
+		}
+		s.snapshots[id] = snapshot
+		s.mu.Unlock()
+		clbStateLastRefreshTimestamp.WithLabelValues(id).Set(float64(snapshot.fetchedAt.Unix()))
+	}
+	return errors.Join(errs...)
+}
+
+// missing 返回尚无快照的负载均衡器
+func (s *clbState) missing(loadBalancerIDs []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for _, id := range loadBalancerIDs {
+		if _, ok := s.snapshots[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// retain 丢弃不再出现在规则中的负载均衡器的快照
+func (s *clbState) retain(loadBalancerIDs []string) {
+	keep := make(map[string]struct{}, len(loadBalancerIDs))
+	for _, id := range loadBalancerIDs {
+		keep[id] = struct{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.snapshots {
+		if _, ok := keep[id]; !ok {
+			delete(s.snapshots, id)
+			delete(s.recorded, id)
+			clbStateLastRefreshTimestamp.DeleteLabelValues(id)
+		}
+	}
+}
+
+// listeners 返回负载均衡器最近一次成功获取的监听器
+func (s *clbState) listeners(loadBalancerID string) ([]Listener, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[loadBalancerID]
+	if !ok {
+		return nil, false
+	}
+	return snapshot.listeners, true
+}
+
+// backends 返回转发规则上当前绑定的后端
+func (s *clbState) backends(target ConfigTarget) []Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[target.LoadBalancerID]
+	if !ok {
+		return nil
+	}
+	backends := snapshot.backends[locationKey(target.ListenerID, target.LocationID)]
+	return append([]Backend(nil), backends...)
+}
+
+// record 在绑定/解绑完成后更新快照中的后端，避免在下次刷新前重复操作
+func (s *clbState) record(target ConfigTarget, added, removed []Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded[target.LoadBalancerID]++
+	snapshot, ok := s.snapshots[target.LoadBalancerID]
+	if !ok {
+		return
+	}
+	key := locationKey(target.ListenerID, target.LocationID)
+
+	drop := make(map[Backend]struct{}, len(removed))
+	for _, backend := range removed {
+		drop[backend] = struct{}{}
+	}
+
+	var backends []Backend
+	seen := make(map[Backend]struct{})
+	for _, backend := range append(snapshot.backends[key], added...) {
+		if _, found := drop[backend]; found {
+			continue
+		}
+		if _, found := seen[backend]; found {
+			continue
+		}
+		seen[backend] = struct{}{}
+		backends = append(backends, backend)
+	}
+	snapshot.backends[key] = backends
+
+	for backend := range drop {
+		delete(snapshot.weights[key], backend)
+	}
+}
+
+// weights 返回转发规则上当前绑定的后端的权重
+func (s *clbState) weights(target ConfigTarget) map[Backend]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[target.LoadBalancerID]
+	if !ok {
+		return nil
+	}
+	weights := make(map[Backend]int)
+	for backend, weight := range snapshot.weights[locationKey(target.ListenerID, target.LocationID)] {
+		weights[backend] = weight
+	}
+	return weights
+}
+
+// recordWeights 在绑定或修改权重完成后更新快照中的后端权重
+func (s *clbState) recordWeights(target ConfigTarget, weights map[Backend]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded[target.LoadBalancerID]++
+	snapshot, ok := s.snapshots[target.LoadBalancerID]
+	if !ok {
+		return
+	}
+	key := locationKey(target.ListenerID, target.LocationID)
+	if snapshot.weights[key] == nil {
+		snapshot.weights[key] = make(map[Backend]int)
+	}
+	for backend, weight := range weights {
+		snapshot.weights[key][backend] = weight
+	}
+}
+
+func locationKey(listenerID, locationID string) string {
+	return listenerID + "/" + locationID
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testListeners(ips ...string) []Listener {
+	var targets []Target
+	for _, ip := range ips {
+		targets = append(targets, Target{Port: 8080, PrivateIPAddresses: []string{ip}})
+	}
+	return []Listener{{
+		ListenerID: "lbl-1",
+		Port:       80,
+		Protocol:   "HTTP",
+		Rules: []Rule{{
+			Domain:     "example.com",
+			URL:        "/api",
+			LocationID: "loc-1",
+			Targets:    targets,
+		}},
+	}}
+}
+
+var testTarget = ConfigTarget{LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-1", Port: 8080}
+
+func TestCLBStateKeepsSnapshotOnFailure(t *testing.T) {
+	var fail bool
+	state := newCLBState(func(string) ([]Listener, error) {
+		if fail {
+			return nil, errors.New("RequestLimitExceeded")
+		}
+		return testListeners("10.0.0.1"), nil
+	})
+
+	if err := state.refresh([]string{"lb-00000001"}); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+
+	fail = true
+	if err := state.refresh([]string{"lb-00000001"}); err == nil {
+		t.Fatal("refresh() error = nil, want error")
+	}
+
+	if _, ok := state.listeners("lb-00000001"); !ok {
+		t.Fatal("listeners() dropped snapshot after failed refresh")
+	}
+	want := []Backend{{IP: "10.0.0.1", Port: 8080}}
+	if got := state.backends(testTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("backends() = %v, want %v", got, want)
+	}
+}
+
+func TestCLBStateRecord(t *testing.T) {
+	state := newCLBState(func(string) ([]Listener, error) {
+		return testListeners("10.0.0.1", "10.0.0.2"), nil
+	})
+	state.refresh([]string{"lb-00000001"})
+
+	state.record(testTarget, []Backend{{IP: "10.0.0.3", Port: 8080}, {IP: "10.0.0.1", Port: 8080}}, nil)
+	state.record(testTarget, nil, []Backend{{IP: "10.0.0.2", Port: 8080}})
+
+	want := []Backend{{IP: "10.0.0.1", Port: 8080}, {IP: "10.0.0.3", Port: 8080}}
+	if got := state.backends(testTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("backends() = %v, want %v", got, want)
+	}
+}
+
+func TestCLBStateDiscardsRefreshRacingWithRecord(t *testing.T) {
+	var state *clbState
+	racing := false
+	state = newCLBState(func(string) ([]Listener, error) {
+		if racing {
+			// 查询期间另一个同步完成了绑定
+			state.record(testTarget, []Backend{{IP: "10.0.0.2", Port: 8080}}, nil)
+		}
+		return testListeners("10.0.0.1"), nil
+	})
+	state.refresh([]string{"lb-00000001"})
+
+	racing = true
+	state.refresh([]string{"lb-00000001"})
+	want := []Backend{{IP: "10.0.0.1", Port: 8080}, {IP: "10.0.0.2", Port: 8080}}
+	if got := state.backends(testTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("backends() = %v, want %v to keep the recorded registration", got, want)
+	}
+
+	racing = false
+	state.refresh([]string{"lb-00000001"})
+	want = []Backend{{IP: "10.0.0.1", Port: 8080}}
+	if got := state.backends(testTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("backends() = %v, want %v after the next refresh", got, want)
+	}
+}
+
+func TestCLBStateWeights(t *testing.T) {
+	state := newCLBState(func(string) ([]Listener, error) {
+		listeners := testListeners("10.0.0.1", "10.0.0.2")
+		listeners[0].Rules[0].Targets[0].Weight = 10
+		listeners[0].Rules[0].Targets[1].Weight = 30
+		return listeners, nil
+	})
+	state.refresh([]string{"lb-00000001"})
+
+	state.recordWeights(testTarget, map[Backend]int{{IP: "10.0.0.1", Port: 8080}: 50})
+	state.record(testTarget, nil, []Backend{{IP: "10.0.0.2", Port: 8080}})
+
+	want := map[Backend]int{{IP: "10.0.0.1", Port: 8080}: 50}
+	if got := state.weights(testTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("weights() = %v, want %v", got, want)
+	}
+}
+
+func TestCLBStateRetain(t *testing.T) {
+	state := newCLBState(func(string) ([]Listener, error) { return testListeners(), nil })
+	state.refresh([]string{"lb-00000001", "lb-2"})
+
+	state.retain([]string{"lb-2"})
+
+	if got := state.missing([]string{"lb-00000001", "lb-2"}); !reflect.DeepEqual(got, []string{"lb-00000001"}) {
+		t.Errorf("missing() = %v, want [lb-1]", got)
+	}
+}
+
+func TestConfigKeepsTargetsWhenStateRefreshFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := `- load_balancer_id: lb-00000001
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: example.com
+          url: /api
+          backend:
+            namespace: default
+            deployment: my-app
+            port: 8080
+`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var fail bool
+	cfg := &Config{
+		source:        newFileRulesSource(path),
+		rulesInterval: time.Hour,
+		stateInterval: time.Hour,
+		tencent:       newTestClientPool(),
+	}
+	cfg.state = newCLBState(func(string) ([]Listener, error) {
+		if fail {
+			return nil, errors.New("InternalError")
+		}
+		return testListeners("10.0.0.1"), nil
+	})
+
+	cfg.refreshMu.Lock()
+	if err := cfg.loadRules(); err != nil {
+		t.Fatalf("loadRules() error = %v", err)
+	}
+	cfg.refreshMu.Unlock()
+
+	want := []ConfigTarget{testTarget}
+	if got := cfg.GetTargets("default/my-app"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetTargets() = %v, want %v", got, want)
+	}
+
+	// 状态刷新失败时沿用上一次的快照
+	fail = true
+	cfg.refreshMu.Lock()
+	cfg.refreshState()
+	cfg.refreshMu.Unlock()
+
+	if got := cfg.GetTargets("default/my-app"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTargets() after failed refresh = %v, want %v", got, want)
+	}
+	if got := cfg.GetBackendIPs(testTarget); !reflect.DeepEqual(got, []string{"10.0.0.1"}) {
+		t.Errorf("GetBackendIPs() after failed refresh = %v, want [10.0.0.1]", got)
+	}
+
+	// 规则解析失败时保留之前的规则
+	os.WriteFile(path, []byte("- load_balancer_id: [\n"), 0o644)
+	if _, err := cfg.Reload(); err == nil {
+		t.Fatal("Reload() error = nil, want parse error")
+	}
+	if got := cfg.GetTargets("default/my-app"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTargets() after failed reload = %v, want %v", got, want)
+	}
+}
+
+func TestConfigRunRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := `- load_balancer_id: lb-00000001
+  listeners:
+    - port: 80
+      protocol: http
+      rules:
+        - domain: example.com
+          url: /api
+          backend:
+            namespace: default
+            deployment: my-app
+            port: 8080
+`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		describe int
+	)
+	release := make(chan struct{})
+	cfg := &Config{
+		source:        newFileRulesSource(path),
+		rulesInterval: time.Hour,
+		stateInterval: 10 * time.Millisecond,
+		tencent:       newTestClientPool(),
+	}
+	cfg.state = newCLBState(func(string) ([]Listener, error) {
+		mu.Lock()
+		describe++
+		n := describe
+		mu.Unlock()
+		// 后台刷新阻塞在 CLB 查询上
+		if n > 1 {
+			<-release
+		}
+		return testListeners("10.0.0.1"), nil
+	})
+	cfg.refreshMu.Lock()
+	cfg.loadRules()
+	cfg.refreshMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg.RunRefresh(ctx, func([]string) {})
+
+	// 状态按间隔刷新，不依赖同步调用 GetTargets
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := describe
+		mu.Unlock()
+		if n > 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("state was not refreshed in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 刷新进行中时同步读取目标不等待
+	done := make(chan []ConfigTarget)
+	go func() { done <- cfg.GetTargets("default/my-app") }()
+	select {
+	case got := <-done:
+		if want := []ConfigTarget{testTarget}; !reflect.DeepEqual(got, want) {
+			t.Errorf("GetTargets() = %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetTargets() blocked on a state refresh")
+	}
+	close(release)
+}
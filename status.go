@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 默认查询的控制器状态地址
+const defaultStatusURL = "http://localhost:8080/status"
+
+// runStatus 实现 status 子命令：从运行中的控制器获取状态并输出，存在无效文件、冲突或无法匹配的配置时退出码为 1
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	url := fs.String("url", defaultStatusURL, "status endpoint of the running controller")
+	fs.Parse(args)
+
+	status, err := fetchStatus(*url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get status: %v\n", err)
+		return 1
+	}
+
+	printStatus(os.Stdout, status)
+	if status.problems() != nil {
+		return 1
+	}
+	return 0
+}
+
+func fetchStatus(url string) (ControllerStatus, error) {
+	var status ControllerStatus
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("failed to decode status: %v", err)
+	}
+	return status, nil
+}
+
+func printStatus(w io.Writer, status ControllerStatus) {
+	fmt.Fprintf(w, "Rules:            %s\n", status.Rules.Source)
+	fmt.Fprintf(w, "Version:          %s\n", status.Rules.Version)
+	fmt.Fprintf(w, "Loaded at:        %s\n", status.Rules.LoadedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Files:            %d\n", len(status.Rules.Files))
+	for _, file := range status.Rules.Files {
+		if file.Error != "" {
+			fmt.Fprintf(w, "  %s: %d bindings, invalid: %s\n", file.Name, file.Bindings, file.Error)
+		} else {
+			fmt.Fprintf(w, "  %s: %d bindings\n", file.Name, file.Bindings)
+		}
+	}
+	fmt.Fprintf(w, "Conflicts:        %d\n", len(status.Conflicts))
+	for _, conflict := range status.Conflicts {
+		fmt.Fprintf(w, "  %s\n", conflict)
+	}
+	fmt.Fprintf(w, "Unresolved rules: %d\n", len(status.UnresolvedRules))
+	for _, u := range status.UnresolvedRules {
+		fmt.Fprintf(w, "  %s\n", u)
+	}
+	if status.Freeze.Frozen {
+		fmt.Fprintf(w, "Frozen:           yes (%s)\n", strings.Join(status.Freeze.Sources, ", "))
+	} else {
+		fmt.Fprintf(w, "Frozen:           no\n")
+	}
+	fmt.Fprintf(w, "Skipped changes:  %d\n", len(status.Freeze.SkippedChanges))
+	for _, change := range status.Freeze.SkippedChanges {
+		fmt.Fprintf(w, "  %s\n", change)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeReporter struct {
+	status ControllerStatus
+	ready  error
+}
+
+func (f fakeReporter) Status() ControllerStatus { return f.status }
+func (f fakeReporter) Ready() error             { return f.ready }
+
+func TestReadyEndpoint(t *testing.T) {
+	unresolved := ControllerStatus{UnresolvedRules: []UnresolvedRule{{
+		LoadBalancerID: "lb-abcd1234",
+		Port:           443,
+		Domain:         "test.example.com",
+		URL:            "/",
+		Reason:         "listener not found",
+	}}}
+
+	tests := []struct {
+		name     string
+		status   ControllerStatus
+		ready    error
+		want     int
+		wantBody []string
+	}{
+		{"ready", ControllerStatus{}, nil, http.StatusOK, []string{"ok"}},
+		{"not ready", ControllerStatus{}, errors.New("rules have not been loaded"), http.StatusServiceUnavailable, []string{"rules have not been loaded"}},
+		{"unresolved rules are reported but ready", unresolved, nil, http.StatusOK, []string{"ok", "unresolved rule:", "lb-abcd1234"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(newHTTPServer("", fakeReporter{status: tt.status, ready: tt.ready}, nil).Handler)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/ready")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("/ready status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("/ready body = %q, want it to contain %q", body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchStatus(t *testing.T) {
+	reporter := fakeReporter{status: ControllerStatus{
+		Rules: RulesStatus{Source: "rules.yaml", Version: "abc123"},
+		UnresolvedRules: []UnresolvedRule{{
+			LoadBalancerID: "lb-00000001",
+			Protocol:       "https",
+			Port:           443,
+			Domain:         "example.com",
+			URL:            "/",
+			Namespace:      "default",
+			Deployment:     "web",
+			Reason:         "no HTTPS listener on port 443",
+		}},
+	}}
+	server := httptest.NewServer(newHTTPServer("", reporter, nil).Handler)
+	defer server.Close()
+
+	status, err := fetchStatus(server.URL + "/status")
+	if err != nil {
+		t.Fatalf("fetchStatus() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	printStatus(&out, status)
+	for _, want := range []string{
+		"Version:          abc123",
+		"Unresolved rules: 1",
+		"lb-00000001 HTTPS:443 example.com/ -> default/web: no HTTPS listener on port 443",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printStatus() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
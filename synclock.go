@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// keyedLocks 为每个 key 提供一把互斥锁，不再使用的锁会被删除
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu sync.Mutex
+	// 持有或等待该锁的调用方数量
+	refs int
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{locks: make(map[string]*keyedLock)}
+}
+
+// lock 阻塞直到获得 key 的锁，返回释放锁的函数
+func (l *keyedLocks) lock(key string) func() {
+	l.mu.Lock()
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &keyedLock{}
+		l.locks[key] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedLocks(t *testing.T) {
+	locks := newKeyedLocks()
+
+	var (
+		wg       sync.WaitGroup
+		inFlight int32
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock("default/web")
+			defer unlock()
+			if atomic.AddInt32(&inFlight, 1) > 1 {
+				t.Errorf("holders of the same key should be serialized")
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+
+	// 不同的 key 互不阻塞
+	unlock := locks.lock("default/api")
+	done := make(chan struct{})
+	go func() {
+		locks.lock("default/other")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("different keys should not block each other")
+	}
+	unlock()
+
+	wg.Wait()
+	if len(locks.locks) != 0 {
+		t.Errorf("released locks should be removed, %d left", len(locks.locks))
+	}
+}
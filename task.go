@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+const (
+	defaultTaskTimeout      = 60 * time.Second
+	defaultTaskPollInterval = time.Second
+)
+
+// DescribeTaskStatus 返回的任务状态
+const (
+	taskStatusSucceeded  int64 = 0
+	taskStatusFailed     int64 = 1
+	taskStatusInProgress int64 = 2
+)
+
+// TaskFailedError 表示 CLB 异步任务执行失败
+type TaskFailedError struct {
+	RequestID string
+}
+
+func (e *TaskFailedError) Error() string {
+	return fmt.Sprintf("CLB task %s failed", e.RequestID)
+}
+
+// waitForTask 轮询异步任务状态，直到任务成功、失败或超时
+func (tc *TencentClient) waitForTask(requestID string) error {
+	return pollTaskStatus(requestID, tc.taskTimeout, tc.taskPollInterval, tc.describeTaskStatus)
+}
+
+func (tc *TencentClient) describeTaskStatus(requestID string) (int64, error) {
+	request := clb.NewDescribeTaskStatusRequest()
+	request.TaskId = common.StringPtr(requestID)
+
+	var status int64
+	err := tc.call("DescribeTaskStatus", func(ctx context.Context) error {
+		response, err := tc.sdkClient().DescribeTaskStatusWithContext(ctx, request)
+		if err != nil {
+			return err
+		}
+		if response.Response.Status == nil {
+			return fmt.Errorf("DescribeTaskStatus returned no status for task %s", requestID)
+		}
+		status = *response.Response.Status
+		return nil
+	})
+	return status, err
+}
+
+func pollTaskStatus(requestID string, timeout, interval time.Duration, describe func(string) (int64, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := describe(requestID)
+		if err != nil {
+			return fmt.Errorf("failed to describe task %s: %w", requestID, err)
+		}
+
+		switch status {
+		case taskStatusSucceeded:
+			return nil
+		case taskStatusFailed:
+			return &TaskFailedError{RequestID: requestID}
+		case taskStatusInProgress:
+		default:
+			return fmt.Errorf("unknown status %d for task %s", status, requestID)
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("task %s did not complete within %v", requestID, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
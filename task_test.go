@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPollTaskStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int64
+		err      error
+		wantErr  bool
+		wantPoll int
+	}{
+		{name: "succeeds immediately", statuses: []int64{taskStatusSucceeded}, wantPoll: 1},
+		{name: "succeeds after progress", statuses: []int64{taskStatusInProgress, taskStatusInProgress, taskStatusSucceeded}, wantPoll: 3},
+		{name: "task fails", statuses: []int64{taskStatusInProgress, taskStatusFailed}, wantErr: true, wantPoll: 2},
+		{name: "describe fails", err: fmt.Errorf("boom"), wantErr: true, wantPoll: 1},
+		{name: "times out", statuses: []int64{taskStatusInProgress, taskStatusInProgress, taskStatusInProgress, taskStatusInProgress}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			err := pollTaskStatus("req-1", 50*time.Millisecond, time.Millisecond, func(requestID string) (int64, error) {
+				polls++
+				if tt.err != nil {
+					return 0, tt.err
+				}
+				if polls > len(tt.statuses) {
+					return taskStatusInProgress, nil
+				}
+				return tt.statuses[polls-1], nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pollTaskStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantPoll > 0 && polls != tt.wantPoll {
+				t.Errorf("polled %d times, want %d", polls, tt.wantPoll)
+			}
+		})
+	}
+}
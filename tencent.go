@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
@@ -13,8 +15,22 @@ import (
 )
 
 type TencentClient struct {
-	client *clb.Client
-	region string
+	// client 绑定 clientCredential 快照，凭证刷新后由 sdkClient 重建
+	clientMu         sync.Mutex
+	client           *clb.Client
+	clientCredential *credentialValue
+	credential       common.CredentialIface
+	newClient        func(credential common.CredentialIface) (*clb.Client, error)
+
+	region    string
+	batchSize int
+	retry     retryPolicy
+
+	taskTimeout      time.Duration
+	taskPollInterval time.Duration
+
+	queue   *mutationQueue
+	limiter *apiRateLimiter
 }
 
 type RegisterTarget struct {
@@ -23,6 +39,8 @@ type RegisterTarget struct {
 	LocationID     string
 	Port           int
 	EniIP          string
+	// 为 nil 时使用 CLB 默认权重
+	Weight *int
 }
 
 type DeregisterTarget struct {
@@ -33,6 +51,15 @@ type DeregisterTarget struct {
 	Port           int
 }
 
+type WeightTarget struct {
+	LoadBalancerID string
+	ListenerID     string
+	LocationID     string
+	EniIP          string
+	Port           int
+	Weight         int
+}
+
 type Listener struct {
 	ListenerID string `json:"ListenerId"`
 	Port       int    `json:"Port"`
@@ -49,6 +76,7 @@ type Rule struct {
 
 type Target struct {
 	Port               int      `json:"Port"`
+	Weight             int      `json:"Weight"`
 	PrivateIPAddresses []string `json:"PrivateIpAddresses"`
 }
 
@@ -63,96 +91,272 @@ type DescribeTargetsResponse struct {
 	} `json:"Response"`
 }
 
-func NewTencentClient() (*TencentClient, error) {
-	secretID := os.Getenv("CLOUD_TENCENT_SECRET_ID")
-	secretKey := os.Getenv("CLOUD_TENCENT_SECRET_KEY")
-	region := os.Getenv("TENCENT_REGION")
+// tencentSettings 是所有腾讯云客户端共享的调用参数
+type tencentSettings struct {
+	batchSize int
+	retry     retryPolicy
+
+	taskTimeout      time.Duration
+	taskPollInterval time.Duration
+
+	maxParallelLBs   int
+	defaultRateLimit rateLimit
+	rateLimits       map[string]rateLimit
 
-	if secretID == "" || secretKey == "" {
-		return nil, fmt.Errorf("CLOUD_TENCENT_SECRET_ID and CLOUD_TENCENT_SECRET_KEY must be set")
+	endpoint endpointSettings
+	// 获取临时凭证使用的 STS 接入点
+	stsEndpoint endpointSettings
+}
+
+func newTencentSettingsFromEnv() (tencentSettings, error) {
+	var settings tencentSettings
+	var err error
+
+	if settings.batchSize, err = envInt("CLB_BATCH_SIZE", maxBatchTargets); err != nil {
+		return settings, err
+	}
+	if settings.batchSize <= 0 || settings.batchSize > maxBatchTargets {
+		return settings, fmt.Errorf("CLB_BATCH_SIZE must be between 1 and %d", maxBatchTargets)
 	}
 
-	if region == "" {
-		region = "ap-beijing" // 默认区域
+	if settings.retry, err = newRetryPolicyFromEnv(); err != nil {
+		return settings, err
 	}
 
-	credential := common.NewCredential(secretID, secretKey)
-	cpf := profile.NewClientProfile()
-	cpf.HttpProfile.Endpoint = "clb.tencentcloudapi.com"
+	if settings.taskTimeout, err = envDuration("CLB_TASK_TIMEOUT", defaultTaskTimeout); err != nil {
+		return settings, err
+	}
+	if settings.taskPollInterval, err = envDuration("CLB_TASK_POLL_INTERVAL", defaultTaskPollInterval); err != nil {
+		return settings, err
+	}
+	if settings.taskTimeout <= 0 || settings.taskPollInterval <= 0 {
+		return settings, fmt.Errorf("CLB_TASK_TIMEOUT and CLB_TASK_POLL_INTERVAL must be greater than 0")
+	}
 
-	client, err := clb.NewClient(credential, region, cpf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create tencent client: %v", err)
+	if settings.maxParallelLBs, err = envInt("CLB_MAX_PARALLEL_LBS", defaultMaxParallelLBs); err != nil {
+		return settings, err
+	}
+	if settings.maxParallelLBs <= 0 {
+		return settings, fmt.Errorf("CLB_MAX_PARALLEL_LBS must be greater than 0")
+	}
+
+	if settings.defaultRateLimit, settings.rateLimits, err = rateLimitsFromEnv(); err != nil {
+		return settings, err
 	}
 
-	return &TencentClient{
-		client: client,
-		region: region,
-	}, nil
+	if settings.endpoint, err = endpointSettingsFromEnv(); err != nil {
+		return settings, err
+	}
+	if settings.stsEndpoint, err = stsEndpointSettings(settings.endpoint); err != nil {
+		return settings, err
+	}
+	return settings, nil
 }
 
-func (tc *TencentClient) BatchRegisterTargets(loadBalancerID string, targets []RegisterTarget) error {
-	request := clb.NewBatchRegisterTargetsRequest()
-	request.LoadBalancerId = common.StringPtr(loadBalancerID)
+func newTencentClient(region string, credential common.CredentialIface, settings tencentSettings, limits clientLimits) (*TencentClient, error) {
+	cpf := profile.NewClientProfile()
+	cpf.HttpProfile.Scheme = settings.endpoint.scheme
+	cpf.HttpProfile.Endpoint = settings.endpoint.endpoint
+	cpf.HttpProfile.ReqTimeout = int(settings.endpoint.requestTimeout / time.Second)
 
-	var clbTargets []*clb.BatchTarget
-	for _, target := range targets {
-		clbTarget := &clb.BatchTarget{
-			ListenerId: common.StringPtr(target.ListenerID),
-			Port:       common.Int64Ptr(int64(target.Port)),
-			EniIp:      common.StringPtr(target.EniIP),
+	newClient := func(credential common.CredentialIface) (*clb.Client, error) {
+		client, err := clb.NewClient(credential, region, cpf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tencent client: %v", err)
 		}
-		if target.LocationID != "" {
-			clbTarget.LocationId = common.StringPtr(target.LocationID)
+		if settings.endpoint.transport != nil {
+			client.WithHttpTransport(settings.endpoint.transport)
 		}
-		clbTargets = append(clbTargets, clbTarget)
+		return client, nil
+	}
+	client, err := newClient(credential)
+	if err != nil {
+		return nil, err
 	}
-	request.Targets = clbTargets
 
-	response, err := tc.client.BatchRegisterTargets(request)
-	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		log.Errorf("An API error has returned: %s", err)
-		return err
+	tc := &TencentClient{
+		client:     client,
+		credential: credential,
+		newClient:  newClient,
+		region:     region,
+		batchSize:  settings.batchSize,
+		retry:      settings.retry,
+
+		taskTimeout:      settings.taskTimeout,
+		taskPollInterval: settings.taskPollInterval,
+
+		limiter: limits.limiter,
 	}
+	tc.queue = newMutationQueue(limits.lbSlots, tc.applyMutation)
+
+	return tc, nil
+}
+
+// sdkClient 返回绑定当前凭证快照的 SDK 客户端。SDK 签名时分别读取 Token、SecretKey 和 SecretId，
+// 因此每个快照使用独立的客户端，凭证在两次读取之间刷新也不会签出 SecretId、SecretKey 和 Token 不匹配的请求
+func (tc *TencentClient) sdkClient() *clb.Client {
+	tc.clientMu.Lock()
+	defer tc.clientMu.Unlock()
+
+	credential, ok := tc.credential.(*refreshingCredential)
+	if !ok {
+		return tc.client
+	}
+	value := credential.snapshot()
+	if value == tc.clientCredential {
+		return tc.client
+	}
+	client, err := tc.newClient(value.credential())
 	if err != nil {
-		log.Errorf("Failed to register targets: %v", err)
-		return err
+		log.Errorf("Failed to create CLB client for the refreshed credential: %v", err)
+		return tc.client
 	}
+	tc.client, tc.clientCredential = client, value
+	return client
+}
 
-	log.Debugf("BatchRegisterTargets response: %s", response.ToJsonString())
-	return nil
+// call 在限速器放行后执行 API 调用，并按重试策略重试
+func (tc *TencentClient) call(action string, fn func(ctx context.Context) error) error {
+	return tc.retry.do(action, func(ctx context.Context) error {
+		if err := tc.limiter.wait(ctx, action); err != nil {
+			return err
+		}
+		return fn(ctx)
+	})
 }
 
-func (tc *TencentClient) BatchDeregisterTargets(loadBalancerID string, targets []DeregisterTarget) error {
-	request := clb.NewBatchDeregisterTargetsRequest()
-	request.LoadBalancerId = common.StringPtr(loadBalancerID)
+// applyMutation 由操作队列调用，发送合并后的绑定/解绑请求
+func (tc *TencentClient) applyMutation(loadBalancerID string, kind mutationKind, targets []*clb.BatchTarget) ([]string, error) {
+	switch kind {
+	case mutationRegister:
+		return tc.registerTargets(loadBalancerID, targets)
+	case mutationModifyWeight:
+		return tc.modifyTargetWeights(loadBalancerID, targets)
+	}
+	return tc.deregisterTargets(loadBalancerID, targets)
+}
 
+// BatchRegisterTargets 绑定后端，返回执行绑定的请求的 RequestId
+func (tc *TencentClient) BatchRegisterTargets(loadBalancerID string, targets []RegisterTarget) ([]string, error) {
 	var clbTargets []*clb.BatchTarget
 	for _, target := range targets {
-		clbTarget := &clb.BatchTarget{
-			ListenerId: common.StringPtr(target.ListenerID),
-			Port:       common.Int64Ptr(int64(target.Port)),
-			EniIp:      common.StringPtr(target.EniIP),
-		}
-		if target.LocationID != "" {
-			clbTarget.LocationId = common.StringPtr(target.LocationID)
+		clbTarget := newBatchTarget(target.ListenerID, target.LocationID, target.EniIP, target.Port)
+		if target.Weight != nil {
+			clbTarget.Weight = common.Int64Ptr(int64(*target.Weight))
 		}
 		clbTargets = append(clbTargets, clbTarget)
 	}
-	request.Targets = clbTargets
 
-	response, err := tc.client.BatchDeregisterTargets(request)
-	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		log.Errorf("An API error has returned: %s", err)
-		return err
+	// 同一负载均衡器的变更需排队串行执行
+	return tc.queue.submit(loadBalancerID, mutationRegister, clbTargets)
+}
+
+func (tc *TencentClient) registerTargets(loadBalancerID string, clbTargets []*clb.BatchTarget) ([]string, error) {
+	return tc.runBatches("BatchRegisterTargets", loadBalancerID, clbTargets, func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error) {
+		request := clb.NewBatchRegisterTargetsRequest()
+		request.LoadBalancerId = common.StringPtr(loadBalancerID)
+		request.Targets = chunk
+
+		response, err := tc.sdkClient().BatchRegisterTargetsWithContext(ctx, request)
+		if _, ok := err.(*errors.TencentCloudSDKError); ok {
+			log.Errorf("An API error has returned: %s", err)
+			return nil, "", err
+		}
+		if err != nil {
+			log.Errorf("Failed to register targets: %v", err)
+			return nil, "", err
+		}
+
+		log.Debugf("BatchRegisterTargets response: %s", response.ToJsonString())
+		return response.Response.FailListenerIdSet, stringValue(response.Response.RequestId), nil
+	})
+}
+
+// BatchDeregisterTargets 解绑后端，返回执行解绑的请求的 RequestId
+func (tc *TencentClient) BatchDeregisterTargets(loadBalancerID string, targets []DeregisterTarget) ([]string, error) {
+	var clbTargets []*clb.BatchTarget
+	for _, target := range targets {
+		clbTargets = append(clbTargets, newBatchTarget(target.ListenerID, target.LocationID, target.EniIP, target.Port))
 	}
-	if err != nil {
-		log.Errorf("Failed to deregister targets: %v", err)
-		return err
+
+	// 同一负载均衡器的变更需排队串行执行
+	return tc.queue.submit(loadBalancerID, mutationDeregister, clbTargets)
+}
+
+func (tc *TencentClient) deregisterTargets(loadBalancerID string, clbTargets []*clb.BatchTarget) ([]string, error) {
+	return tc.runBatches("BatchDeregisterTargets", loadBalancerID, clbTargets, func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error) {
+		request := clb.NewBatchDeregisterTargetsRequest()
+		request.LoadBalancerId = common.StringPtr(loadBalancerID)
+		request.Targets = chunk
+
+		response, err := tc.sdkClient().BatchDeregisterTargetsWithContext(ctx, request)
+		if _, ok := err.(*errors.TencentCloudSDKError); ok {
+			log.Errorf("An API error has returned: %s", err)
+			return nil, "", err
+		}
+		if err != nil {
+			log.Errorf("Failed to deregister targets: %v", err)
+			return nil, "", err
+		}
+
+		log.Debugf("BatchDeregisterTargets response: %s", response.ToJsonString())
+		return response.Response.FailListenerIdSet, stringValue(response.Response.RequestId), nil
+	})
+}
+
+// BatchModifyTargetWeight 修改已绑定后端的权重，不会重新绑定后端，返回执行修改的请求的 RequestId
+func (tc *TencentClient) BatchModifyTargetWeight(loadBalancerID string, targets []WeightTarget) ([]string, error) {
+	var clbTargets []*clb.BatchTarget
+	for _, target := range targets {
+		clbTarget := newBatchTarget(target.ListenerID, target.LocationID, target.EniIP, target.Port)
+		clbTarget.Weight = common.Int64Ptr(int64(target.Weight))
+		clbTargets = append(clbTargets, clbTarget)
 	}
 
-	log.Debugf("BatchDeregisterTargets response: %s", response.ToJsonString())
-	return nil
+	// 同一负载均衡器的变更需排队串行执行
+	return tc.queue.submit(loadBalancerID, mutationModifyWeight, clbTargets)
+}
+
+func (tc *TencentClient) modifyTargetWeights(loadBalancerID string, clbTargets []*clb.BatchTarget) ([]string, error) {
+	return tc.runBatches("BatchModifyTargetWeight", loadBalancerID, clbTargets, func(ctx context.Context, chunk []*clb.BatchTarget) ([]*string, string, error) {
+		request := clb.NewBatchModifyTargetWeightRequest()
+		request.LoadBalancerId = common.StringPtr(loadBalancerID)
+		request.ModifyList = rsWeightRules(chunk)
+
+		response, err := tc.sdkClient().BatchModifyTargetWeightWithContext(ctx, request)
+		if _, ok := err.(*errors.TencentCloudSDKError); ok {
+			log.Errorf("An API error has returned: %s", err)
+			return nil, "", err
+		}
+		if err != nil {
+			log.Errorf("Failed to modify target weights: %v", err)
+			return nil, "", err
+		}
+
+		log.Debugf("BatchModifyTargetWeight response: %s", response.ToJsonString())
+		return nil, stringValue(response.Response.RequestId), nil
+	})
+}
+
+// rsWeightRules 按监听器和转发规则将后端分组为修改权重请求的参数，每个后端使用各自的权重
+func rsWeightRules(targets []*clb.BatchTarget) []*clb.RsWeightRule {
+	var rules []*clb.RsWeightRule
+	byLocation := make(map[string]*clb.RsWeightRule)
+	for _, target := range targets {
+		key := locationKey(stringValue(target.ListenerId), stringValue(target.LocationId))
+		rule, ok := byLocation[key]
+		if !ok {
+			rule = &clb.RsWeightRule{ListenerId: target.ListenerId, LocationId: target.LocationId}
+			byLocation[key] = rule
+			rules = append(rules, rule)
+		}
+		rule.Targets = append(rule.Targets, &clb.Target{
+			Port:   target.Port,
+			EniIp:  target.EniIp,
+			Weight: target.Weight,
+		})
+	}
+	return rules
 }
 
 func (tc *TencentClient) DescribeTargets(loadBalancerID string, listenerIDs []string) (*DescribeTargetsResponse, error) {
@@ -167,7 +371,12 @@ func (tc *TencentClient) DescribeTargets(loadBalancerID string, listenerIDs []st
 		request.ListenerIds = ids
 	}
 
-	response, err := tc.client.DescribeTargets(request)
+	var response *clb.DescribeTargetsResponse
+	err := tc.call("DescribeTargets", func(ctx context.Context) error {
+		var err error
+		response, err = tc.sdkClient().DescribeTargetsWithContext(ctx, request)
+		return err
+	})
 	if _, ok := err.(*errors.TencentCloudSDKError); ok {
 		log.Errorf("An API error has returned: %s", err)
 		return nil, err
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// CLB 公网和内网（VPC 内无需公网出口）接入点
+	defaultCLBEndpoint  = "clb.tencentcloudapi.com"
+	internalCLBEndpoint = "clb.internal.tencentcloudapi.com"
+
+	// STS 公网和内网接入点，AssumeRole 和 AssumeRoleWithWebIdentity 凭证来源使用
+	defaultSTSEndpoint  = "sts.tencentcloudapi.com"
+	internalSTSEndpoint = "sts.internal.tencentcloudapi.com"
+
+	defaultRequestTimeout = 60 * time.Second
+)
+
+// endpointSettings 描述 CLB API 的接入点与 HTTP 连接参数
+type endpointSettings struct {
+	scheme         string
+	endpoint       string
+	requestTimeout time.Duration
+	transport      *http.Transport
+}
+
+// endpointSettingsFromEnv 读取 CLB_ENDPOINT、CLB_USE_INTERNAL_ENDPOINT、CLB_HTTP_PROXY、
+// CLB_REQUEST_TIMEOUT 和 CLB_CA_BUNDLE
+func endpointSettingsFromEnv() (endpointSettings, error) {
+	settings := endpointSettings{scheme: "HTTPS", endpoint: defaultCLBEndpoint}
+
+	if os.Getenv("CLB_USE_INTERNAL_ENDPOINT") == "true" {
+		settings.endpoint = internalCLBEndpoint
+	}
+	if value := os.Getenv("CLB_ENDPOINT"); value != "" {
+		scheme, endpoint, err := parseEndpoint(value)
+		if err != nil {
+			return settings, fmt.Errorf("invalid CLB_ENDPOINT %q: %v", value, err)
+		}
+		settings.scheme, settings.endpoint = scheme, endpoint
+	}
+
+	var err error
+	if settings.requestTimeout, err = envDuration("CLB_REQUEST_TIMEOUT", defaultRequestTimeout); err != nil {
+		return settings, err
+	}
+	if settings.requestTimeout < time.Second {
+		return settings, fmt.Errorf("CLB_REQUEST_TIMEOUT must be at least 1s")
+	}
+
+	settings.transport, err = newHTTPTransport(os.Getenv("CLB_HTTP_PROXY"), os.Getenv("CLB_CA_BUNDLE"))
+	if err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// stsEndpointSettings 返回 STS API 的接入点，与 CLB API 使用相同的代理、CA 证书和请求超时，
+// 以便在只允许访问内网接入点或只能经代理出网的环境中刷新临时凭证。
+// CLB_USE_INTERNAL_ENDPOINT 同时切换到 STS 内网接入点，CLOUD_TENCENT_STS_ENDPOINT 可覆盖接入点
+func stsEndpointSettings(clbSettings endpointSettings) (endpointSettings, error) {
+	settings := clbSettings
+	settings.scheme, settings.endpoint = "HTTPS", defaultSTSEndpoint
+
+	if os.Getenv("CLB_USE_INTERNAL_ENDPOINT") == "true" {
+		settings.endpoint = internalSTSEndpoint
+	}
+	if value := os.Getenv("CLOUD_TENCENT_STS_ENDPOINT"); value != "" {
+		scheme, endpoint, err := parseEndpoint(value)
+		if err != nil {
+			return settings, fmt.Errorf("invalid CLOUD_TENCENT_STS_ENDPOINT %q: %v", value, err)
+		}
+		settings.scheme, settings.endpoint = scheme, endpoint
+	}
+	return settings, nil
+}
+
+// parseEndpoint 解析 "host[:port]" 或 "http(s)://host[:port]" 形式的接入点，
+// 返回 SDK 使用的 scheme 和域名
+func parseEndpoint(value string) (string, string, error) {
+	if !strings.Contains(value, "://") {
+		if strings.ContainsAny(value, "/?#") {
+			return "", "", fmt.Errorf("endpoint must not contain a path")
+		}
+		return "HTTPS", value, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return "", "", fmt.Errorf("endpoint must be scheme://host[:port]")
+	}
+	switch u.Scheme {
+	case "http":
+		return "HTTP", u.Host, nil
+	case "https":
+		return "HTTPS", u.Host, nil
+	default:
+		return "", "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+}
+
+// newHTTPTransport 构造 CLB 和 STS API 使用的 HTTP Transport。proxyURL 为空时沿用
+// HTTPS_PROXY 等标准环境变量；caBundle 中的证书会追加到系统根证书之后
+func newHTTPTransport(proxyURL, caBundle string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid CLB_HTTP_PROXY %q", proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CLB_CA_BUNDLE: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CLB_CA_BUNDLE %s", caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return transport, nil
+}
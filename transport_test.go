@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantScheme string
+		wantHost   string
+		wantErr    bool
+	}{
+		{value: "clb.internal.tencentcloudapi.com", wantScheme: "HTTPS", wantHost: "clb.internal.tencentcloudapi.com"},
+		{value: "http://127.0.0.1:8081", wantScheme: "HTTP", wantHost: "127.0.0.1:8081"},
+		{value: "https://clb.example.com/", wantScheme: "HTTPS", wantHost: "clb.example.com"},
+		{value: "ftp://clb.example.com", wantErr: true},
+		{value: "https://clb.example.com/path", wantErr: true},
+		{value: "clb.example.com/path", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			scheme, host, err := parseEndpoint(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if scheme != tt.wantScheme || host != tt.wantHost {
+				t.Errorf("parseEndpoint() = %q, %q, want %q, %q", scheme, host, tt.wantScheme, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestNewHTTPTransportCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	transport, err := newHTTPTransport("", bundle)
+	if err != nil {
+		t.Fatalf("newHTTPTransport() error = %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := newHTTPTransport("", filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("newHTTPTransport() should fail for a missing CA bundle")
+	}
+	if _, err := newHTTPTransport("not a url", ""); err == nil {
+		t.Error("newHTTPTransport() should fail for an invalid proxy")
+	}
+}
+
+func TestTencentClientAgainstMockServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.Header.Get("X-TC-Action"); action != "DescribeTargets" {
+			t.Errorf("unexpected action %q", action)
+		}
+		fmt.Fprint(w, `{"Response":{"Listeners":[{"ListenerId":"lbl-1","Port":443,"Protocol":"HTTPS","Rules":[]}],"RequestId":"req-1"}}`)
+	}))
+	defer server.Close()
+
+	scheme, endpoint, err := parseEndpoint(server.URL)
+	if err != nil {
+		t.Fatalf("parseEndpoint() error = %v", err)
+	}
+	transport, _ := newHTTPTransport("", "")
+
+	settings := tencentSettings{
+		batchSize:      maxBatchTargets,
+		retry:          testRetryPolicy,
+		maxParallelLBs: 1,
+		endpoint: endpointSettings{
+			scheme:         scheme,
+			endpoint:       endpoint,
+			requestTimeout: 5 * time.Second,
+			transport:      transport,
+		},
+	}
+	tc, err := newTencentClient("ap-beijing", common.NewCredential("id", "key"), settings, newClientLimits(settings))
+	if err != nil {
+		t.Fatalf("newTencentClient() error = %v", err)
+	}
+
+	response, err := tc.DescribeTargets("lb-1", nil)
+	if err != nil {
+		t.Fatalf("DescribeTargets() error = %v", err)
+	}
+	if len(response.Response.Listeners) != 1 || response.Response.Listeners[0].ListenerID != "lbl-1" {
+		t.Errorf("unexpected listeners: %+v", response.Response.Listeners)
+	}
+}
+
+func TestSTSEndpointSettings(t *testing.T) {
+	transport, _ := newHTTPTransport("", "")
+	clbSettings := endpointSettings{scheme: "HTTPS", endpoint: internalCLBEndpoint, requestTimeout: 10 * time.Second, transport: transport}
+
+	t.Setenv("CLB_USE_INTERNAL_ENDPOINT", "true")
+	t.Setenv("CLOUD_TENCENT_STS_ENDPOINT", "")
+	settings, err := stsEndpointSettings(clbSettings)
+	if err != nil {
+		t.Fatalf("stsEndpointSettings() error = %v", err)
+	}
+	if settings.endpoint != internalSTSEndpoint || settings.transport != transport || settings.requestTimeout != 10*time.Second {
+		t.Errorf("stsEndpointSettings() = %+v, want the internal endpoint with the CLB transport and timeout", settings)
+	}
+
+	t.Setenv("CLOUD_TENCENT_STS_ENDPOINT", "http://127.0.0.1:8082")
+	if settings, _ = stsEndpointSettings(clbSettings); settings.scheme != "HTTP" || settings.endpoint != "127.0.0.1:8082" {
+		t.Errorf("stsEndpointSettings() = %+v, want the CLOUD_TENCENT_STS_ENDPOINT override", settings)
+	}
+	t.Setenv("CLOUD_TENCENT_STS_ENDPOINT", "ftp://sts.example.com")
+	if _, err := stsEndpointSettings(clbSettings); err == nil {
+		t.Error("stsEndpointSettings() should fail for an invalid endpoint")
+	}
+}
+
+func TestSTSCredentialSourceAgainstMockServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.Header.Get("X-TC-Action"); action != "AssumeRoleWithWebIdentity" {
+			t.Errorf("unexpected action %q", action)
+		}
+		fmt.Fprint(w, `{"Response":{"Credentials":{"Token":"tmp-token","TmpSecretId":"tmp-id","TmpSecretKey":"tmp-key"},"ExpiredTime":1900000000,"RequestId":"req-1"}}`)
+	}))
+	defer server.Close()
+
+	scheme, endpoint, _ := parseEndpoint(server.URL)
+	transport, _ := newHTTPTransport("", "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("web-identity-token"), 0600)
+
+	source := &stsCredentialSource{
+		region:          "ap-beijing",
+		roleArn:         "qcs::cam::uin/100:roleName/clb",
+		roleSessionName: defaultRoleSessionName,
+		duration:        defaultRoleDuration,
+		endpoint:        endpointSettings{scheme: scheme, endpoint: endpoint, requestTimeout: 5 * time.Second, transport: transport},
+		providerID:      "provider",
+		tokenFile:       tokenFile,
+	}
+	value, err := source.retrieve()
+	if err != nil {
+		t.Fatalf("retrieve() error = %v", err)
+	}
+	if value.secretID != "tmp-id" || value.token != "tmp-token" || value.expiresAt.Unix() != 1900000000 {
+		t.Errorf("retrieve() = %+v", value)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	loadBalancerIDPattern = regexp.MustCompile(`^lb-[a-z0-9]{8}$`)
+	// yaml 错误信息中的行号，如 "line 5: field protocl not found in type main.ListenerConfig"
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// 支持的监听器协议，控制器只处理七层转发规则
+var supportedProtocols = map[string]struct{}{
+	"http":  {},
+	"https": {},
+}
+
+// ValidationError 是规则文件中某一行的错误
+type ValidationError struct {
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ValidationErrors 是规则文件中的所有错误
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// parseRules 替换变量引用后严格解析规则（拒绝未知字段和类型不匹配），并进行语义校验。
+// 顶层为列表时按 v1 格式解析，为映射时按 apiVersion 指定的格式解析
+func parseRules(data []byte) ([]RuleConfig, error) {
+	data, err := interpolateRules(data, lookupRulesVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(err)
+	}
+
+	var (
+		rules []RuleConfig
+		nodes []ruleNodes
+	)
+	doc := documentContent(&root)
+	if doc != nil && doc.Kind == yaml.MappingNode {
+		rules, nodes, err = parseRulesV2(data, doc)
+	} else {
+		rules, nodes, err = parseRulesV1(data, doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if errs := validateRules(rules, nodes); len(errs) > 0 {
+		return nil, errs
+	}
+	return rules, nil
+}
+
+func parseRulesV1(data []byte, doc *yaml.Node) ([]RuleConfig, []ruleNodes, error) {
+	var rules []RuleConfig
+	if err := decodeStrict(data, &rules); err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []ruleNodes
+	for _, item := range sequenceItems(doc) {
+		r := ruleNodes{node: item, id: fieldNode(item, "load_balancer_id")}
+		for _, listener := range sequenceItems(fieldNode(item, "listeners")) {
+			l := listenerNodes{
+				node:     listener,
+				port:     fieldNode(listener, "port"),
+				protocol: fieldNode(listener, "protocol"),
+			}
+			for _, rule := range sequenceItems(fieldNode(listener, "rules")) {
+				b := backendNodes(rule, fieldNode(rule, "backend"))
+				b.split = fieldNode(rule, "backends")
+				for _, member := range sequenceItems(b.split) {
+					b.members = append(b.members, backendNodes(member, member))
+				}
+				l.rules = append(l.rules, b)
+			}
+			r.listeners = append(r.listeners, l)
+		}
+		nodes = append(nodes, r)
+	}
+	return rules, nodes, nil
+}
+
+// decodeStrict 解析 yaml 并拒绝未知字段
+func decodeStrict(data []byte, out interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && err != io.EOF {
+		return yamlErrors(err)
+	}
+	return nil
+}
+
+// ruleNodes 记录一个负载均衡器配置中各字段所在的 yaml 节点，用于在校验错误中给出行号。
+// 字段未出现在文件中时对应的节点为 nil
+type ruleNodes struct {
+	node      *yaml.Node
+	id        *yaml.Node
+	listeners []listenerNodes
+}
+
+type listenerNodes struct {
+	node     *yaml.Node
+	port     *yaml.Node
+	protocol *yaml.Node
+	rules    []bindingNodes
+}
+
+type bindingNodes struct {
+	node       *yaml.Node
+	backend    *yaml.Node
+	namespace  *yaml.Node
+	deployment *yaml.Node
+	port       *yaml.Node
+	weight     *yaml.Node
+	slowStart  *yaml.Node
+	safety     *yaml.Node
+	share      *yaml.Node
+	// 按比例分配流量时的 backends 列表及其中每个后端
+	split   *yaml.Node
+	members []bindingNodes
+}
+
+func (b bindingNodes) member(i int) bindingNodes {
+	if i < len(b.members) {
+		return b.members[i]
+	}
+	return bindingNodes{node: lineNode(b.split, b.node)}
+}
+
+// backendNodes 返回后端映射节点中各字段所在的节点
+func backendNodes(node, backend *yaml.Node) bindingNodes {
+	return bindingNodes{
+		node:       node,
+		backend:    backend,
+		namespace:  fieldNode(backend, "namespace"),
+		deployment: fieldNode(backend, "deployment"),
+		port:       fieldNode(backend, "port"),
+		weight:     fieldNode(backend, "weight"),
+		slowStart:  lineNode(fieldNode(backend, "slow_start"), fieldNode(backend, "slowStart")),
+		safety:     fieldNode(backend, "safety"),
+		share:      fieldNode(backend, "share"),
+	}
+}
+
+func (r ruleNodes) listener(i int) listenerNodes {
+	if i < len(r.listeners) {
+		return r.listeners[i]
+	}
+	return listenerNodes{node: r.node}
+}
+
+func (l listenerNodes) rule(i int) bindingNodes {
+	if i < len(l.rules) {
+		return l.rules[i]
+	}
+	return bindingNodes{node: l.node}
+}
+
+// lineNode 返回第一个非 nil 节点
+func lineNode(nodes ...*yaml.Node) *yaml.Node {
+	for _, node := range nodes {
+		if node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// lineOf 返回第一个非 nil 节点所在的行
+func lineOf(nodes ...*yaml.Node) int {
+	for _, node := range nodes {
+		if node != nil {
+			return node.Line
+		}
+	}
+	return 0
+}
+
+// yamlErrors 将 yaml 库的错误转换为带行号的错误
+func yamlErrors(err error) ValidationErrors {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	var errs ValidationErrors
+	for _, message := range messages {
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			errs = append(errs, ValidationError{Line: line, Message: match[2]})
+		} else {
+			errs = append(errs, ValidationError{Message: message})
+		}
+	}
+	return errs
+}
+
+// validateRules 对解析后的规则进行语义校验，nodes 用于定位错误所在的行
+func validateRules(rules []RuleConfig, nodes []ruleNodes) ValidationErrors {
+	var errs ValidationErrors
+	addf := func(line int, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, rule := range rules {
+		var r ruleNodes
+		if i < len(nodes) {
+			r = nodes[i]
+		}
+		if !loadBalancerIDPattern.MatchString(rule.LoadBalancerID) {
+			addf(lineOf(r.id, r.node), "invalid load balancer ID %q, expected lb- followed by 8 lowercase letters or digits", rule.LoadBalancerID)
+		}
+
+		seenListeners := make(map[string]struct{})
+		for j, listener := range rule.Listeners {
+			l := r.listener(j)
+			if listener.Port < 1 || listener.Port > 65535 {
+				addf(lineOf(l.port, l.node), "listener port %d out of range 1-65535", listener.Port)
+			}
+			if _, ok := supportedProtocols[strings.ToLower(listener.Protocol)]; !ok {
+				addf(lineOf(l.protocol, l.node), "unsupported protocol %q, expected http or https", listener.Protocol)
+			}
+			listenerKey := fmt.Sprintf("%s:%d", strings.ToLower(listener.Protocol), listener.Port)
+			if _, dup := seenListeners[listenerKey]; dup {
+				addf(lineOf(l.node), "duplicate listener %s on %s", listenerKey, rule.LoadBalancerID)
+			}
+			seenListeners[listenerKey] = struct{}{}
+
+			seenRules := make(map[string]struct{})
+			for k, listenerRule := range listener.Rules {
+				b := l.rule(k)
+				if listenerRule.Domain == "" {
+					addf(lineOf(b.node), "domain must not be empty")
+				}
+				if listenerRule.URL == "" {
+					addf(lineOf(b.node), "url must not be empty")
+				}
+				ruleKey := listenerRule.Domain + listenerRule.URL
+				if _, dup := seenRules[ruleKey]; dup {
+					addf(lineOf(b.node), "duplicate rule %s on listener %s", ruleKey, listenerKey)
+				}
+				seenRules[ruleKey] = struct{}{}
+
+				if len(listenerRule.Backends) == 0 {
+					validateBackend(listenerRule.Backend, b, addf)
+					continue
+				}
+
+				if listenerRule.Backend != (BackendConfig{}) {
+					addf(lineOf(b.backend, b.node), "backend and backends must not both be set")
+				}
+				total := 0
+				seenBackends := make(map[string]struct{})
+				for m, member := range listenerRule.Backends {
+					mb := b.member(m)
+					validateBackend(member.BackendConfig, mb, addf)
+					if member.Weight != nil {
+						addf(lineOf(mb.weight, mb.node), "weight is not supported in backends, use share")
+					}
+					if member.Share < 0 || member.Share > 100 {
+						addf(lineOf(mb.share, mb.node), "backend share %d out of range 0-100", member.Share)
+					}
+					total += member.Share
+
+					backendKey := member.Namespace + "/" + member.Deployment
+					if _, dup := seenBackends[backendKey]; dup {
+						addf(lineOf(mb.node), "duplicate backend %s", backendKey)
+					}
+					seenBackends[backendKey] = struct{}{}
+				}
+				if total != 100 {
+					addf(lineOf(b.split, b.node), "backend shares add up to %d, expected 100", total)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateBackend 校验单个后端，b 用于定位错误所在的行
+func validateBackend(backend BackendConfig, b bindingNodes, addf func(line int, format string, args ...interface{})) {
+	if backend.Namespace == "" {
+		addf(lineOf(b.backend, b.node), "backend namespace must not be empty")
+	} else if msgs := validation.IsDNS1123Label(backend.Namespace); len(msgs) > 0 {
+		addf(lineOf(b.namespace, b.backend, b.node), "invalid backend namespace %q: %s", backend.Namespace, strings.Join(msgs, ", "))
+	}
+	if backend.Deployment == "" {
+		addf(lineOf(b.backend, b.node), "backend deployment must not be empty")
+	} else if msgs := validation.IsDNS1123Subdomain(backend.Deployment); len(msgs) > 0 {
+		addf(lineOf(b.deployment, b.backend, b.node), "invalid backend deployment %q: %s", backend.Deployment, strings.Join(msgs, ", "))
+	}
+	if backend.Port < 1 || backend.Port > 65535 {
+		addf(lineOf(b.port, b.backend, b.node), "backend port %d out of range 1-65535", backend.Port)
+	}
+	if backend.Weight != nil && (*backend.Weight < 0 || *backend.Weight > maxTargetWeight) {
+		addf(lineOf(b.weight, b.backend, b.node), "backend weight %d out of range 0-%d", *backend.Weight, maxTargetWeight)
+	}
+	if backend.SlowStart < 0 {
+		addf(lineOf(b.slowStart, b.backend, b.node), "backend slow start %s must not be negative", backend.SlowStart)
+	}
+	for _, msg := range backend.Safety.validate() {
+		addf(lineOf(b.safety, b.backend, b.node), "%s", msg)
+	}
+}
+
+func documentContent(root *yaml.Node) *yaml.Node {
+	if root != nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		return root.Content[0]
+	}
+	return nil
+}
+
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	if node != nil && node.Kind == yaml.SequenceNode {
+		return node.Content
+	}
+	return nil
+}
+
+// fieldNode 返回映射节点中某个字段的值节点，找不到时返回 nil
+func fieldNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// runValidate 实现 validate 子命令：校验规则文件或目录，按 "文件:行: 错误" 的格式输出错误，
+// 多个文件之间存在冲突时同样视为失败
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.StringVar(&clusterName, "cluster-name", envString(clusterNameVariable, ""), "cluster name available to rules files as ${CLUSTER_NAME} (env CLUSTER_NAME)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [-cluster-name name] [file|dir ...]\n\nValidate rules files, defaults to RULES_DIR, RULES_FILE or %s.\n", os.Args[0], defaultRulesPath)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{envString("RULES_DIR", envString("RULES_FILE", defaultRulesPath))}
+	}
+
+	failed := false
+	var docs []rulesDocument
+	for _, path := range paths {
+		var source rulesSource = newFileRulesSource(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			source = newDirRulesSource(path)
+		}
+		found, _, err := source.read()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		docs = append(docs, found...)
+	}
+
+	var files []rulesFile
+	for _, doc := range docs {
+		rules, err := parseRules(doc.data)
+		if err != nil {
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				errs = ValidationErrors{{Message: err.Error()}}
+			}
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s\n", doc.name, e.Line, e.Message)
+			}
+			failed = true
+			continue
+		}
+		files = append(files, rulesFile{name: doc.name, rules: rules})
+		fmt.Printf("%s: OK\n", doc.name)
+	}
+
+	_, conflicts, _ := mergeRules(files, nil)
+	for _, conflict := range conflicts {
+		fmt.Fprintf(os.Stderr, "%s: conflict: %s\n", conflict.File, conflict)
+	}
+
+	if failed || len(conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
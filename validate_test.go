@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const validRules = `- load_balancer_id: lb-abcd1234
+  listeners:
+    - port: 443
+      protocol: https
+      rules:
+        - domain: test.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: test
+            port: 80
+`
+
+const splitRules = `- load_balancer_id: lb-abcd1234
+  listeners:
+    - port: 443
+      protocol: https
+      rules:
+        - domain: test.example.com
+          url: /
+          backends:
+            - namespace: default
+              deployment: api-stable
+              port: 80
+              share: 90
+            - namespace: default
+              deployment: api-canary
+              port: 80
+              share: 10
+`
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantLines []int
+		wantMsg   string
+	}{
+		{
+			name: "valid",
+			data: validRules,
+		},
+		{
+			name: "empty",
+			data: "",
+		},
+		{
+			name:      "unknown field",
+			data:      strings.Replace(validRules, "protocol: https", "protocl: https", 1),
+			wantLines: []int{4},
+			wantMsg:   "field protocl not found",
+		},
+		{
+			name:      "port as string",
+			data:      strings.Replace(validRules, "port: 443", `port: "https"`, 1),
+			wantLines: []int{3},
+			wantMsg:   "cannot unmarshal",
+		},
+		{
+			name:      "invalid load balancer id",
+			data:      strings.Replace(validRules, "lb-abcd1234", "lb-***", 1),
+			wantLines: []int{1},
+			wantMsg:   "invalid load balancer ID",
+		},
+		{
+			name:      "unsupported protocol",
+			data:      strings.Replace(validRules, "protocol: https", "protocol: tcp", 1),
+			wantLines: []int{4},
+			wantMsg:   "unsupported protocol",
+		},
+		{
+			name:      "backend port out of range",
+			data:      strings.Replace(validRules, "port: 80\n", "port: 70000\n", 1),
+			wantLines: []int{11},
+			wantMsg:   "backend port 70000 out of range",
+		},
+		{
+			name: "weight",
+			data: strings.Replace(validRules, "port: 80\n", "port: 80\n            weight: 0\n", 1),
+		},
+		{
+			name:      "weight out of range",
+			data:      strings.Replace(validRules, "port: 80\n", "port: 80\n            weight: 101\n", 1),
+			wantLines: []int{12},
+			wantMsg:   "backend weight 101 out of range 0-100",
+		},
+		{
+			name: "slow start",
+			data: strings.Replace(validRules, "port: 80\n", "port: 80\n            slow_start: 2m\n", 1),
+		},
+		{
+			name:      "invalid slow start",
+			data:      strings.Replace(validRules, "port: 80\n", "port: 80\n            slow_start: soon\n", 1),
+			wantLines: []int{12},
+			wantMsg:   "cannot unmarshal",
+		},
+		{
+			name: "safety",
+			data: strings.Replace(validRules, "port: 80\n", "port: 80\n            safety:\n              min_backends: 2\n              max_removal_percent: 30\n", 1),
+		},
+		{
+			name:      "invalid safety",
+			data:      strings.Replace(validRules, "port: 80\n", "port: 80\n            safety:\n              min_percent: 150\n", 1),
+			wantLines: []int{13},
+			wantMsg:   "safety min percent 150 out of range 0-100",
+		},
+		{
+			name: "split",
+			data: splitRules,
+		},
+		{
+			name:      "split shares do not add up",
+			data:      strings.Replace(splitRules, "share: 10", "share: 20", 1),
+			wantLines: []int{9},
+			wantMsg:   "backend shares add up to 110, expected 100",
+		},
+		{
+			name:      "split with weight",
+			data:      strings.Replace(splitRules, "share: 10", "share: 10\n              weight: 5", 1),
+			wantLines: []int{17},
+			wantMsg:   "weight is not supported in backends",
+		},
+		{
+			name:      "split with duplicate backend",
+			data:      strings.Replace(splitRules, "api-canary", "api-stable", 1),
+			wantLines: []int{13},
+			wantMsg:   "duplicate backend default/api-stable",
+		},
+		{
+			name: "backend and backends",
+			data: strings.Replace(splitRules, "          backends:", `          backend:
+            namespace: default
+            deployment: test
+            port: 80
+          backends:`, 1),
+			wantLines: []int{9},
+			wantMsg:   "backend and backends must not both be set",
+		},
+		{
+			name:      "missing deployment",
+			data:      strings.Replace(validRules, "            deployment: test\n", "", 1),
+			wantLines: []int{9},
+			wantMsg:   "backend deployment must not be empty",
+		},
+		{
+			name: "duplicate domain and url",
+			data: validRules + `        - domain: test.example.com
+          url: /
+          backend:
+            namespace: default
+            deployment: other
+            port: 80
+`,
+			wantLines: []int{12},
+			wantMsg:   "duplicate rule",
+		},
+		{
+			name:      "syntax error",
+			data:      "- load_balancer_id: [\n",
+			wantLines: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRules([]byte(tt.data))
+			if tt.wantLines == nil {
+				if err != nil {
+					t.Fatalf("parseRules() error = %v", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("parseRules() error = %v, want ValidationErrors", err)
+			}
+			var lines []int
+			for _, e := range errs {
+				lines = append(lines, e.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("parseRules() error lines = %v, want %v (%v)", lines, tt.wantLines, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("parseRules() error = %v, want message containing %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRunValidateClusterName(t *testing.T) {
+	t.Setenv(clusterNameVariable, "")
+	defer func() { clusterName = "" }()
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	data := strings.Replace(validRules, "test.example.com", "${CLUSTER_NAME}.example.com", 1)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runValidate([]string{path}); code != 1 {
+		t.Errorf("runValidate() without -cluster-name = %d, want 1", code)
+	}
+	if code := runValidate([]string{"-cluster-name", "staging", path}); code != 0 {
+		t.Errorf("runValidate() with -cluster-name = %d, want 0", code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// 规则变化后等待的时间，用于合并短时间内的多次写入
+const rulesReloadDebounce = 500 * time.Millisecond
+
+// WatchRules 监听规则来源，变化后立即重新加载，并以目标发生变化的
+// namespace/deployment 调用 onReload
+func (c *Config) WatchRules(ctx context.Context, onReload func(changed []string)) error {
+	events := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+	if err := c.source.watch(ctx, notify); err != nil {
+		return err
+	}
+
+	go func() {
+		timer := time.NewTimer(rulesReloadDebounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-events:
+				timer.Reset(rulesReloadDebounce)
+			case <-timer.C:
+				changed, err := c.Reload()
+				if err != nil {
+					log.Errorf("Failed to reload rules from %s: %v", c.source, err)
+				}
+				log.Infof("Reloaded rules from %s, %d bindings changed", c.source, len(changed))
+				if len(changed) > 0 {
+					onReload(changed)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// watch 监听规则文件所在目录而非文件本身，以便感知 ConfigMap 挂载时
+// ..data 符号链接的原子切换
+func (s *fileRulesSource) watch(ctx context.Context, notify func()) error {
+	return watchDir(ctx, filepath.Dir(s.path), func(event fsnotify.Event) bool {
+		return isRulesEvent(event, s.path)
+	}, notify)
+}
+
+// watch 监听规则目录中的 *.yaml、*.yml 文件以及 ConfigMap 的 ..data 符号链接
+func (s *dirRulesSource) watch(ctx context.Context, notify func()) error {
+	return watchDir(ctx, s.dir, func(event fsnotify.Event) bool {
+		if event.Op == fsnotify.Chmod {
+			return false
+		}
+		name := filepath.Base(event.Name)
+		return name == "..data" || (!strings.HasPrefix(name, ".") && isRulesFileName(name))
+	}, notify)
+}
+
+// watchDir 在后台监听目录，match 返回 true 的事件会触发 notify
+func watchDir(ctx context.Context, dir string, match func(fsnotify.Event) bool, notify func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create rules watcher: %v", err)
+	}
+
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %v", dir, err)
+	}
+	log.Infof("Watching %s for changes", dir)
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !match(event) {
+					continue
+				}
+				log.Debugf("Rules file event: %v", event)
+				notify()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("Rules watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// isRulesEvent 判断事件是否涉及规则文件本身或 ConfigMap 的 ..data 符号链接
+func isRulesEvent(event fsnotify.Event, path string) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Base(event.Name)
+	return filepath.Clean(event.Name) == filepath.Clean(path) || name == "..data"
+}
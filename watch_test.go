@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestChangedTargetKeys(t *testing.T) {
+	a := ConfigTarget{LoadBalancerID: "lb-1", ListenerID: "lbl-1", LocationID: "loc-1", Port: 80}
+	b := ConfigTarget{LoadBalancerID: "lb-1", ListenerID: "lbl-1", LocationID: "loc-2", Port: 80}
+
+	old := map[string][]ConfigTarget{
+		"default/same":    {a},
+		"default/changed": {a},
+		"default/removed": {a},
+	}
+	new := map[string][]ConfigTarget{
+		"default/same":    {a},
+		"default/changed": {a, b},
+		"default/added":   {b},
+	}
+
+	got := changedTargetKeys(old, new)
+	want := []string{"default/added", "default/changed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changedTargetKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestIsRulesEvent(t *testing.T) {
+	path := "/etc/sync-pod-to-clb/rules.yaml"
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{"write rules file", fsnotify.Event{Name: path, Op: fsnotify.Write}, true},
+		{"create rules file", fsnotify.Event{Name: path, Op: fsnotify.Create}, true},
+		{"configmap symlink swap", fsnotify.Event{Name: "/etc/sync-pod-to-clb/..data", Op: fsnotify.Create}, true},
+		{"chmod only", fsnotify.Event{Name: path, Op: fsnotify.Chmod}, false},
+		{"other file", fsnotify.Event{Name: "/etc/sync-pod-to-clb/other.yaml", Op: fsnotify.Write}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRulesEvent(tt.event, path); got != tt.want {
+				t.Errorf("isRulesEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchRulesReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("[]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(newTestClientPool(), newFileRulesSource(path), nil)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	cfg.mu.RLock()
+	firstLoad := cfg.rulesLoadedAt
+	cfg.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cfg.WatchRules(ctx, func([]string) {}); err != nil {
+		t.Fatalf("WatchRules() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("# updated\n[]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		cfg.mu.RLock()
+		defer cfg.mu.RUnlock()
+		return cfg.rulesLoadedAt.After(firstLoad)
+	})
+}
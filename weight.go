@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Pod 上覆盖规则中后端权重的注解
+	podWeightAnnotation = "clb.tencent/weight"
+	// CLB 后端权重的上限
+	maxTargetWeight = 100
+	// 未指定权重时 CLB 使用的默认权重
+	defaultTargetWeight = 10
+)
+
+// podWeight 读取 Pod 的权重注解，未设置或无效时返回 nil
+func podWeight(pod *corev1.Pod) *int {
+	value, ok := pod.Annotations[podWeightAnnotation]
+	if !ok {
+		return nil
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 0 || weight > maxTargetWeight {
+		log.Warnf("Ignoring invalid %s annotation %q on pod %s/%s, expected 0-%d",
+			podWeightAnnotation, value, pod.Namespace, pod.Name, maxTargetWeight)
+		return nil
+	}
+	return &weight
+}
+
+// targetWeight 返回后端的期望权重：Pod 注解优先，其次是规则中的权重，均未设置时返回 nil
+func targetWeight(target ConfigTarget, podWeights map[string]int, ip string) *int {
+	if weight, ok := podWeights[ip]; ok {
+		return &weight
+	}
+	return target.Weight
+}
+
+// weightChanges 返回已绑定且端口一致、但当前权重与 weightFor 给出的期望权重不同的后端，按 IP 排序
+func weightChanges(target ConfigTarget, podIPs []string, weightFor func(ip string) *int, current map[Backend]int) []WeightTarget {
+	var changes []WeightTarget
+	for _, ip := range podIPs {
+		weight := weightFor(ip)
+		if weight == nil {
+			continue
+		}
+		backend := Backend{IP: ip, Port: target.Port}
+		if currentWeight, ok := current[backend]; !ok || currentWeight == *weight {
+			continue
+		}
+		changes = append(changes, WeightTarget{
+			LoadBalancerID: target.LoadBalancerID,
+			ListenerID:     target.ListenerID,
+			LocationID:     target.LocationID,
+			EniIP:          ip,
+			Port:           target.Port,
+			Weight:         *weight,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].EniIP < changes[j].EniIP })
+	return changes
+}
+
+// weightsOf 返回 backends 对应的权重
+func weightsOf(backends []Backend, weights map[Backend]int) map[Backend]int {
+	out := make(map[Backend]int, len(backends))
+	for _, backend := range backends {
+		out[backend] = weights[backend]
+	}
+	return out
+}
+
+func formatWeightTargets(targets []WeightTarget) []string {
+	var out []string
+	for _, t := range targets {
+		out = append(out, fmt.Sprintf("%s:%d=%d", t.EniIP, t.Port, t.Weight))
+	}
+	return out
+}
+
+// splitWeights 计算按比例分配流量时每个后端的 Pod 的权重。每个 Pod 分到的流量为
+// 后端比例除以该后端的 Pod 数量，按比例缩放使分到流量最多的 Pod 的权重为 100，
+// 比例大于 0 的后端的 Pod 权重至少为 1。没有 Pod 的后端的比例不参与计算
+func splitWeights(split []SplitMember, podCounts map[string]int) map[string]int {
+	perPod := make(map[string]float64)
+	var highest float64
+	for _, member := range split {
+		count := podCounts[member.key()]
+		if count == 0 {
+			continue
+		}
+		perPod[member.key()] = float64(member.Share) / float64(count)
+		if perPod[member.key()] > highest {
+			highest = perPod[member.key()]
+		}
+	}
+
+	weights := make(map[string]int, len(split))
+	for _, member := range split {
+		share, ok := perPod[member.key()]
+		if !ok || highest == 0 {
+			weights[member.key()] = 0
+			continue
+		}
+		weight := int(math.Round(share / highest * maxTargetWeight))
+		if weight == 0 && member.Share > 0 {
+			weight = 1
+		}
+		weights[member.key()] = weight
+	}
+	return weights
+}
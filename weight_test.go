@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	clb "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/clb/v20180317"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestPodWeight(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *int
+	}{
+		{name: "no annotation"},
+		{name: "weight", annotations: map[string]string{podWeightAnnotation: "50"}, want: intPtr(50)},
+		{name: "zero", annotations: map[string]string{podWeightAnnotation: "0"}, want: intPtr(0)},
+		{name: "out of range", annotations: map[string]string{podWeightAnnotation: "101"}},
+		{name: "not a number", annotations: map[string]string{podWeightAnnotation: "high"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Annotations: tt.annotations}}
+			if got := podWeight(pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podWeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightChanges(t *testing.T) {
+	target := testTarget
+	target.Weight = intPtr(20)
+	current := map[Backend]int{
+		{IP: "10.0.0.1", Port: 8080}: 20,
+		{IP: "10.0.0.2", Port: 8080}: 10,
+		{IP: "10.0.0.3", Port: 8080}: 10,
+		{IP: "10.0.0.4", Port: 9090}: 10,
+	}
+	podIPs := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	podWeights := map[string]int{"10.0.0.3": 0}
+
+	weightFor := func(ip string) *int { return targetWeight(target, podWeights, ip) }
+	got := weightChanges(target, podIPs, weightFor, current)
+	want := []WeightTarget{
+		{LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-1", EniIP: "10.0.0.2", Port: 8080, Weight: 20},
+		{LoadBalancerID: "lb-00000001", ListenerID: "lbl-1", LocationID: "loc-1", EniIP: "10.0.0.3", Port: 8080, Weight: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("weightChanges() = %+v, want %+v", got, want)
+	}
+
+	// 规则和注解都未设置权重时不修改
+	unmanaged := func(ip string) *int { return targetWeight(testTarget, nil, ip) }
+	if got := weightChanges(testTarget, podIPs, unmanaged, current); got != nil {
+		t.Errorf("weightChanges() without weights = %+v, want nil", got)
+	}
+}
+
+func TestRsWeightRules(t *testing.T) {
+	withWeight := func(target *clb.BatchTarget, weight int64) *clb.BatchTarget {
+		target.Weight = common.Int64Ptr(weight)
+		return target
+	}
+	targets := []*clb.BatchTarget{
+		withWeight(newBatchTarget("lbl-1", "loc-1", "10.0.0.1", 8080), 20),
+		withWeight(newBatchTarget("lbl-1", "loc-2", "10.0.0.1", 8080), 30),
+		withWeight(newBatchTarget("lbl-1", "loc-1", "10.0.0.2", 8080), 0),
+	}
+
+	rules := rsWeightRules(targets)
+	if len(rules) != 2 {
+		t.Fatalf("rsWeightRules() returned %d rules, want 2", len(rules))
+	}
+
+	var got []string
+	for _, rule := range rules {
+		for _, target := range rule.Targets {
+			got = append(got, fmt.Sprintf("%s/%s=%d", *rule.LocationId, *target.EniIp, *target.Weight))
+		}
+	}
+	want := []string{"loc-1/10.0.0.1=20", "loc-1/10.0.0.2=0", "loc-2/10.0.0.1=30"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rsWeightRules() = %v, want %v", got, want)
+	}
+}
+
+func TestSplitWeights(t *testing.T) {
+	split := []SplitMember{
+		{Namespace: "default", Deployment: "api-stable", Port: 8080, Share: 90},
+		{Namespace: "default", Deployment: "api-canary", Port: 8080, Share: 10},
+	}
+
+	tests := []struct {
+		name   string
+		counts map[string]int
+		want   map[string]int
+	}{
+		{
+			name:   "replicas proportional to shares",
+			counts: map[string]int{"default/api-stable": 9, "default/api-canary": 1},
+			want:   map[string]int{"default/api-stable": 100, "default/api-canary": 100},
+		},
+		{
+			name:   "equal replicas",
+			counts: map[string]int{"default/api-stable": 3, "default/api-canary": 3},
+			want:   map[string]int{"default/api-stable": 100, "default/api-canary": 11},
+		},
+		{
+			name:   "small share keeps weight 1",
+			counts: map[string]int{"default/api-stable": 1, "default/api-canary": 20},
+			want:   map[string]int{"default/api-stable": 100, "default/api-canary": 1},
+		},
+		{
+			name:   "no canary pods",
+			counts: map[string]int{"default/api-stable": 4},
+			want:   map[string]int{"default/api-stable": 100, "default/api-canary": 0},
+		},
+		{
+			name:   "no pods",
+			counts: map[string]int{},
+			want:   map[string]int{"default/api-stable": 0, "default/api-canary": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitWeights(split, tt.counts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitWeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}